@@ -0,0 +1,150 @@
+package generator
+
+import (
+	"go/types"
+	"sort"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// DescriptionVersion is the version of the schema of a Description. It
+// changes when a field is removed or changes meaning.
+const DescriptionVersion = 1
+
+// Description is the machine readable description of the HCL2Spec of the
+// generated Flat structs, for editor integrations and docs generators.
+type Description struct {
+	Version int               `json:"version"`
+	Types   []TypeDescription `json:"types"`
+}
+
+// TypeDescription describes the HCL2Spec of a Flat struct.
+type TypeDescription struct {
+	// Name of the Flat struct, ex: FlatConfig.
+	Name string `json:"name"`
+	// Original is the name of the flattened struct, ex: Config. It is empty
+	// for the Flat structs of anonymous structs.
+	Original   string                 `json:"original,omitempty"`
+	Labels     []string               `json:"labels,omitempty"`
+	Attributes []AttributeDescription `json:"attributes"`
+	Blocks     []BlockDescription     `json:"blocks"`
+}
+
+// AttributeDescription describes an attribute of a spec.
+type AttributeDescription struct {
+	Name string `json:"name"`
+	// Type is the cty type of the attribute, ex: string or list(number).
+	Type     string `json:"type"`
+	Required bool   `json:"required"`
+	// Unsupported is set for the fields whose type could not be found, that
+	// are set as a bool.
+	Unsupported bool `json:"unsupported,omitempty"`
+}
+
+// BlockDescription describes a nested block of a spec.
+type BlockDescription struct {
+	Name string `json:"name"`
+	// Nesting is single for a block that can be set once, list for a block
+	// that can be repeated and attrs for a block of string attributes.
+	Nesting string `json:"nesting"`
+	// Type is the name of the Flat struct of the block, or the cty type of
+	// the attributes of an attrs block or of the value of a list of values.
+	Type     string `json:"type"`
+	MinItems int    `json:"min_items,omitempty"`
+	MaxItems int    `json:"max_items,omitempty"`
+}
+
+// describeStructs returns the Description of structs, sorted by name.
+func describeStructs(structs []StructDef) Description {
+	d := Description{Version: DescriptionVersion, Types: []TypeDescription{}}
+	for _, def := range structs {
+		d.Types = append(d.Types, describeStruct(def))
+	}
+	sort.Slice(d.Types, func(i, j int) bool {
+		return d.Types[i].Name < d.Types[j].Name
+	})
+	return d
+}
+
+// describeStruct follows outputStructHCL2SpecBody.
+func describeStruct(def StructDef) TypeDescription {
+	td := TypeDescription{
+		Name:       def.StructName,
+		Original:   def.OriginalStructName,
+		Attributes: []AttributeDescription{},
+		Blocks:     []BlockDescription{},
+	}
+	s := def.Struct
+	for i := 0; i < s.NumFields(); i++ {
+		st, _ := parseTag(s.Tag(i))
+		if m2h, err := st.Get(generatorTag); err == nil && m2h.HasOption("output-only") {
+			continue
+		}
+		ctyTag, err := st.Get("cty")
+		if err != nil {
+			continue
+		}
+		if m2h, err := st.Get(generatorTag); err == nil && m2h.HasOption("label") {
+			td.Labels = append(td.Labels, ctyTag.Name)
+			continue
+		}
+		attr, block := describeField(ctyTag.Name, fieldHCL2Spec(s.Field(i).Type(), st))
+		if block != nil {
+			td.Blocks = append(td.Blocks, *block)
+			continue
+		}
+		if _, isBasic := s.Field(i).Type().Underlying().(*types.Basic); isBasic {
+			// see Options.RequiredFromNonPointer.
+			attr.Required = true
+		}
+		td.Attributes = append(td.Attributes, *attr)
+	}
+	return td
+}
+
+// describeField describes the spec of a field, either as an attribute or as
+// a block.
+func describeField(accessor string, spec fieldSpec) (*AttributeDescription, *BlockDescription) {
+	switch spec.Nesting {
+	case attrsBlock:
+		return nil, &BlockDescription{Name: accessor, Nesting: "attrs", Type: ctyTypeString(spec.Type)}
+	case singleBlock, objectBlock:
+		return nil, &BlockDescription{Name: accessor, Nesting: "single", Type: structName(spec.Struct)}
+	case listBlock:
+		if spec.Values != nil {
+			attr, block := describeField(accessor, *spec.Values)
+			if block != nil {
+				return nil, &BlockDescription{Name: accessor, Nesting: "list", Type: block.Type}
+			}
+			return nil, &BlockDescription{Name: accessor, Nesting: "list", Type: attr.Type}
+		}
+		n := int(spec.Items)
+		return nil, &BlockDescription{Name: accessor, Nesting: "list", Type: structName(spec.Struct), MinItems: n, MaxItems: n}
+	}
+	return &AttributeDescription{Name: accessor, Type: ctyTypeString(spec.Type), Unsupported: spec.Unsupported}, nil
+}
+
+// structName returns the name of the Flat struct t of a block, without its
+// package.
+func structName(t types.Type) string {
+	if named, isNamed := t.(*types.Named); isNamed {
+		return named.Obj().Name()
+	}
+	return t.String()
+}
+
+// ctyTypeString returns t written like in a HCL type constraint, ex:
+// list(string).
+func ctyTypeString(t cty.Type) string {
+	switch {
+	case t == cty.DynamicPseudoType:
+		return "any"
+	case t.IsPrimitiveType():
+		return t.FriendlyName()
+	case t.IsListType():
+		return "list(" + ctyTypeString(t.ElementType()) + ")"
+	case t.IsMapType():
+		return "map(" + ctyTypeString(t.ElementType()) + ")"
+	}
+	return t.FriendlyName()
+}
@@ -0,0 +1,3105 @@
+// Package generator implements mapstructure-to-hcl2, it generates a Flat
+// version of mapstructure decoded structs along with the hcldec.Spec
+// describing them so that they can be decoded from HCL2.
+//
+// Generate can be called directly by programs that don't want to shell out
+// to the mapstructure-to-hcl2 command.
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"go/constant"
+	"go/format"
+	"go/token"
+	"go/types"
+	"io"
+	"log"
+	"math"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/fatih/structtag"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/zclconf/go-cty/cty"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// Options configures what Generate generates.
+type Options struct {
+	// TypeNames are the names of the structs to generate a Flat version of.
+	TypeNames []string
+
+	// Patterns are the packages.Load patterns of the package defining
+	// TypeNames, or .go files of that package. Defaults to the package in
+	// the current directory.
+	Patterns []string
+
+	// BuildTags is a comma-separated list of the build tags to consider
+	// when loading the package, ex: "windows,extra".
+	BuildTags string
+
+	// Tests loads the package along with its _test.go files, so that the
+	// config types of test fixtures can be generated. The generated code
+	// then has to go to a _test.go file too. The external _test packages
+	// are not loaded.
+	Tests bool
+
+	// PackageName is the package of the generated code. Defaults to the
+	// loaded package. In another package, the types of the loaded package
+	// are imported and the FlatMapstructure methods, that can only be
+	// defined in the package of the original structs, are not generated.
+	PackageName string
+
+	// TrimPrefix is trimmed from the names of the types of the loaded
+	// package before prefixing them with Flat, ex: AwsConfig becomes
+	// FlatConfig with an Aws prefix. The Flat types of other packages are
+	// referenced untrimmed as they are generated separately.
+	TrimPrefix string
+
+	// CommandLine is shown in the `Code generated by` header of the
+	// generated code.
+	CommandLine string
+
+	// NoFallback makes Generate fail when the type of a field could not be
+	// found, instead of emitting a TODO bool spec for it.
+	NoFallback bool
+
+	// ToCtyValue generates a ToCtyValue method on each Flat struct, that
+	// converts it to a cty object value of the type implied by its HCL2Spec.
+	ToCtyValue bool
+
+	// DecodeCtyValue generates a DecodeCtyValue method on each Flat struct,
+	// that decodes a cty object value with its HCL2Spec, like a body, so
+	// that tests can build configs as cty values rather than HCL.
+	DecodeCtyValue bool
+
+	// EmptySlicesAsNull makes the ToCtyValue methods convert empty slices to
+	// null lists, like nil slices, as mapstructure does not tell them apart.
+	// By default empty slices are empty lists.
+	EmptySlicesAsNull bool
+
+	// CaptureRanges adds a HCL2Ranges field to each Flat struct and a
+	// CaptureRanges method setting it to the source range of each of the
+	// attributes of a decoded body.
+	CaptureRanges bool
+
+	// CtyToFieldName generates a CtyToFieldName method on each Flat struct,
+	// mapping the cty name of each of its fields to the field name, ex: to
+	// report the errors of a config in terms of its Go fields.
+	CtyToFieldName bool
+
+	// Strict makes Generate fail when some of TypeNames are not found or
+	// when squashed fields share a cty name, instead of warning about them.
+	Strict bool
+
+	// EmitHCLTags adds `hcl` tags next to the `cty` tags of the Flat
+	// structs, so that they can be decoded with gohcl.DecodeBody.
+	EmitHCLTags bool
+
+	// OnlyChanged copies the code of the structs whose hash in Manifest did
+	// not change from Previous instead of generating it again.
+	OnlyChanged bool
+
+	// Previous is the code of the previous generation.
+	Previous []byte
+
+	// Manifest holds the hashes of the previous generation. When it is not
+	// nil, Generate records the hashes of the generated structs in it.
+	Manifest Manifest
+
+	// Description, when not nil, is set to the description of the specs of
+	// the generated structs.
+	Description *Description
+
+	// IgnoreFields are the names of the fields that are not part of the
+	// HCL2 surface whatever their tags, ex: mapstructure decoder metadata
+	// fields.
+	IgnoreFields []string
+
+	// List makes Generate return a summary of the types it would generate,
+	// with their number of fields and the fields of an unhandled type,
+	// instead of their code.
+	List bool
+
+	// MaxDepth is the number of levels of squashed structs that are
+	// flattened. Deeper squashed structs are set in a block delegating to
+	// the HCL2Spec of their Flat type, that must then be generated too. 0
+	// means no limit.
+	MaxDepth int
+
+	// SquashEmbedded squashes the embedded struct fields that don't have a
+	// mapstructure name, the way Go promotes their fields, as if they were
+	// tagged with `mapstructure:",squash"`.
+	SquashEmbedded bool
+
+	// CollapseWrappers sets the fields of a struct type that only wraps a
+	// value as that value, as if they were tagged with
+	// `mapstructure:"x,unwrap"`, ex: `timeout = "1m"` rather than a
+	// `timeout { value = "1m" }` block. See isWrapperStruct.
+	CollapseWrappers bool
+
+	// RequiredFromNonPointer makes the basic fields that are not pointers
+	// in the original struct required, they are then not pointers in the
+	// Flat struct either. Pointer fields stay optional.
+	RequiredFromNonPointer bool
+
+	// NoPointerBasics keeps all the basic fields as their plain type in the
+	// Flat struct, pointers or not in the original struct, so they are all
+	// required. The fields set as strings, ex: a time.Duration, stay
+	// optional.
+	NoPointerBasics bool
+
+	// RequiredFields are the cty names of the basic fields to make
+	// required, in every flattened struct: they are not pointers in the
+	// Flat structs, so their spec is required. This tightens a config field
+	// by field without tagging the original structs.
+	RequiredFields []string
+
+	// All also generates the config-like types of the package: its exported
+	// struct types with at least one mapstructure tag, except the ones of
+	// its generated files. ExcludeTypes are not generated, whether they
+	// come from TypeNames or All.
+	All          bool
+	ExcludeTypes []string
+
+	// Implementing also generates the struct types of the package that
+	// implement this marker interface, or whose pointer does, so that a
+	// new config is generated without being listed. It is the name of an
+	// interface of the package, ex: Configurer, or the fully qualified
+	// name of one of its imports, ex: github.com/foo/bar.Configurer.
+	Implementing string
+
+	// KeepZeroValueDistinction sets the optional basic fields as the
+	// Nullable types of helper/config rather than as pointers, ex: a
+	// config.NullableInt for an int. Their IsSet field tells whether the
+	// attribute was set, so an explicit zero value is not lost. The Flat
+	// structs then get a FromCtyValue method, used by the decode layer in
+	// place of gocty which can't set those.
+	KeepZeroValueDistinction bool
+
+	// FieldRenames sets the cty name of some fields, keyed by the struct
+	// declaring them and their name, ex: "CommonConfig.Name": "common_name".
+	// This resolves the name collisions of squashed structs that can't be
+	// edited, ex: third-party ones.
+	FieldRenames map[string]string
+
+	// IncludeUnexported names the Flat types of the unexported types of
+	// TypeNames like the ones of exported types, ex: FlatConfig for config.
+	// They are named Flatconfig otherwise, which some packages rely on.
+	// Unexported fields are skipped either way.
+	IncludeUnexported bool
+
+	// IncludeNested also generates the struct types of the loaded package
+	// that the Flat structs of TypeNames refer to, ex: Nested for a
+	// *FlatNested field, and so on. They are not generated by default as
+	// they can be generated in another file of the package.
+	IncludeNested bool
+
+	// EmitStringer generates a String method for each Flat struct, showing
+	// the values of its fields rather than the addresses of its pointers,
+	// for debugging.
+	EmitStringer bool
+
+	// Annotate writes a comment after each Flat struct listing the Go type
+	// each of its attributes and blocks is derived from, so that reviewers
+	// can spot a field set as a number that should have been a string.
+	Annotate bool
+
+	// Header is written at the top of the generated file, ex: a license
+	// header. Its lines that are not comments are commented out. It goes
+	// after the "Code generated" marker, or before it when
+	// HeaderBeforeMarker is set; tools find the marker either way.
+	Header             string
+	HeaderBeforeMarker bool
+
+	// FieldTransformers are called in order on each field of the flattened
+	// structs, squashed ones included, before it is handled. See
+	// FieldTransformer.
+	FieldTransformers []FieldTransformer
+
+	// LintSelfDefined warns about the struct fields whose type has its own
+	// HCL2Spec method but that are flattened anyway, because they are not
+	// tagged with `mapstructure-to-hcl2:",self-defined"`.
+	LintSelfDefined bool
+
+	// log positions the fields in the logs with the FileSet of the loaded
+	// package, see logf.
+	log *logger
+}
+
+// FieldTransformer returns the field and tag to generate in place of field and
+// its tag, ex: to set a field of a custom type as a string, or false to skip
+// the field. The types of the returned field are handled like the ones of the
+// original struct, ex: a string becomes a *string.
+type FieldTransformer func(field *types.Var, tag string) (*types.Var, string, bool)
+
+// Generate loads the package matched by opts.Patterns and returns the
+// formatted code of the Flat version of opts.TypeNames along with their
+// HCL2Spec and FlatMapstructure methods. Use LoadPackage to generate several
+// times from the same package.
+func Generate(opts Options) ([]byte, error) {
+	if len(opts.TypeNames) == 0 && !opts.All && opts.Implementing == "" {
+		return nil, fmt.Errorf("no type names given")
+	}
+	pkg, err := LoadPackage(opts)
+	if err != nil {
+		return nil, err
+	}
+	return pkg.Generate(opts)
+}
+
+// Package is a package loaded and type checked once by LoadPackage, the
+// code of any of its types can then be generated without loading it again.
+type Package struct {
+	pkg *packages.Package
+}
+
+// LoadPackage loads the package matched by opts.Patterns with opts.BuildTags,
+// the other options are left to Generate.
+func LoadPackage(opts Options) (*Package, error) {
+	pkgs, err := loadPackage(opts, packages.LoadSyntax)
+	if err != nil {
+		return nil, err
+	}
+	if err := loadErrors(pkgs[0]); err != nil {
+		return nil, err
+	}
+	return &Package{pkg: pkgs[0]}, nil
+}
+
+// Generate is like the Generate function, for the already loaded p: the
+// Patterns and BuildTags of opts are ignored.
+func (p *Package) Generate(opts Options) ([]byte, error) {
+	if len(opts.TypeNames) == 0 && !opts.All && opts.Implementing == "" {
+		return nil, fmt.Errorf("no type names given")
+	}
+	return generate(p.pkg, opts)
+}
+
+// loadErrors returns the errors of loading pkg and its dependencies, as
+// generating from partial type information would silently produce wrong
+// specs.
+func loadErrors(pkg *packages.Package) error {
+	var errs []string
+	packages.Visit([]*packages.Package{pkg}, nil, func(pkg *packages.Package) {
+		for _, err := range pkg.Errors {
+			errs = append(errs, err.Error())
+		}
+	})
+	if len(errs) > 0 {
+		return fmt.Errorf("%s could not be loaded:\n%s", pkg.PkgPath, strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// PackageDir returns the directory of the package matched by opts.Patterns,
+// where its generated code goes by default. This can be another directory
+// than the current one, ex: when go generate is run from the module root.
+func PackageDir(opts Options) (string, error) {
+	pkgs, err := loadPackage(opts, packages.NeedName|packages.NeedFiles)
+	if err != nil {
+		return "", err
+	}
+	if len(pkgs[0].GoFiles) == 0 {
+		return "", fmt.Errorf("%s has no Go files", pkgs[0].PkgPath)
+	}
+	return filepath.Dir(pkgs[0].GoFiles[0]), nil
+}
+
+// loadPackage loads the package matched by opts.Patterns with mode, the
+// returned slice holds exactly that package.
+func loadPackage(opts Options, mode packages.LoadMode) ([]*packages.Package, error) {
+	pkgs, err := loadPackages(opts, mode)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("%d packages found", len(pkgs))
+	}
+	return pkgs, nil
+}
+
+// loadPackages loads the packages matched by opts.Patterns with mode.
+func loadPackages(opts Options, mode packages.LoadMode) ([]*packages.Package, error) {
+	patterns := append([]string(nil), opts.Patterns...)
+	if len(patterns) == 0 {
+		// Default: process whole package in current directory.
+		patterns = []string{"."}
+	}
+	for i, pattern := range patterns {
+		if strings.HasSuffix(pattern, ".go") {
+			// load the whole package of the file, as the types of the file
+			// can be defined in its other files.
+			patterns[i] = "file=" + pattern
+		}
+	}
+
+	cfg := &packages.Config{
+		Mode:  mode,
+		Tests: opts.Tests,
+	}
+	if opts.BuildTags != "" {
+		cfg.BuildFlags = []string{"-tags=" + opts.BuildTags}
+	}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil || !opts.Tests {
+		return pkgs, err
+	}
+	return testVariants(pkgs), nil
+}
+
+// testVariants returns the package of each of pkgs compiled with its
+// _test.go files, ex: the `p [p.test]` variant of p, or p itself when it
+// has no such file. The external test packages and the generated test
+// mains are dropped.
+func testVariants(pkgs []*packages.Package) []*packages.Package {
+	variants := map[string]bool{}
+	for _, pkg := range pkgs {
+		if pkg.ID == pkg.PkgPath+" ["+pkg.PkgPath+".test]" {
+			variants[pkg.PkgPath] = true
+		}
+	}
+	var res []*packages.Package
+	for _, pkg := range pkgs {
+		testMain := pkg.Name == "main" && strings.HasSuffix(pkg.PkgPath, ".test")
+		if variants[pkg.PkgPath] && pkg.ID != pkg.PkgPath || !variants[pkg.PkgPath] && pkg.ID == pkg.PkgPath && !testMain {
+			res = append(res, pkg)
+		}
+	}
+	return res
+}
+
+// generate returns the code of opts.TypeNames from the already loaded
+// topPkg.
+func generate(topPkg *packages.Package, opts Options) ([]byte, error) {
+	if !token.IsIdentifier(topPkg.Name) || topPkg.Name == "_" {
+		// the generated code would not compile.
+		return nil, fmt.Errorf("%s has an invalid package name: %q", topPkg.PkgPath, topPkg.Name)
+	}
+	if opts.PackageName != "" && (!token.IsIdentifier(opts.PackageName) || opts.PackageName == "_") {
+		return nil, fmt.Errorf("invalid package name: %q", opts.PackageName)
+	}
+	if opts.log == nil {
+		opts.log = &logger{}
+	}
+	opts.log.fset = topPkg.Fset
+	candidates := append([]string{}, opts.TypeNames...)
+	if opts.All {
+		candidates = append(candidates, configTypeNames(topPkg)...)
+	}
+	if opts.Implementing != "" {
+		names, err := implementingTypeNames(topPkg, opts.Implementing)
+		if err != nil {
+			return nil, err
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("no type of %s implements %s", topPkg.PkgPath, opts.Implementing)
+		}
+		candidates = append(candidates, names...)
+	}
+	// each type is looked up once.
+	skip := map[string]bool{}
+	for _, name := range opts.ExcludeTypes {
+		skip[name] = true
+	}
+	var typeNames []string
+	for _, name := range candidates {
+		if !skip[name] {
+			typeNames = append(typeNames, name)
+			skip[name] = true
+		}
+	}
+	if opts.All && len(typeNames) == 0 {
+		return nil, fmt.Errorf("no config-like type found in %s", topPkg.PkgPath)
+	}
+	sort.Strings(typeNames)
+
+	var structs []StructDef
+	usedImports := map[NamePath]*types.Package{}
+
+	requested := map[string]bool{}
+	for _, name := range typeNames {
+		requested[name] = true
+	}
+	// with IncludeNested, each pass generates the types that the Flat
+	// structs of the previous one refer to.
+	for {
+		generated := len(structs)
+		for id, obj := range topPkg.TypesInfo.Defs {
+			if obj == nil {
+				continue
+			}
+			t := obj.Type()
+			nt, isANamedType := t.(*types.Named)
+			if !isANamedType {
+				continue
+			}
+			if nt.Obj().Pkg() != topPkg.Types {
+				// Sometimes a struct embeds another struct named the same. ex:
+				// builder/osc/bsuvolume.BlockDevice. This makes sure the type is
+				// defined in topPkg.
+				continue
+			}
+			ut := nt.Underlying()
+			utStruct, utOk := ut.(*types.Struct)
+			if !utOk {
+				continue
+			}
+			pos := sort.SearchStrings(typeNames, id.Name)
+			if pos >= len(typeNames) || typeNames[pos] != id.Name {
+				continue // not a struct we care about
+			}
+			// make sure each type is found once where somehow sometimes they can be found twice
+			typeNames = append(typeNames[:pos], typeNames[pos+1:]...)
+			if isGeneric(nt) {
+				// the Flat struct would need the same type parameters, and
+				// its HCL2Spec would depend on them.
+				p := topPkg.Fset.Position(obj.Pos())
+				return nil, fmt.Errorf("%s:%d: %s has type parameters and can't be flattened, generate an instantiation like `type String%s %s[string]` instead", p.Filename, p.Line, id.Name, id.Name, id.Name)
+			}
+			flatenedStruct, merged, err := getMapstructureSquashedStruct(obj.Pkg(), utStruct, opts, id.Name, 0)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", id.Name, err)
+			}
+			// addCtyTagToStruct only logs the fields it drops, which is fine
+			// for a field of the same type but would hide a bug otherwise.
+			origins := fieldOrigins(id.Name, utStruct, nil)
+			conflicts, dups := duplicateAccessors(flatenedStruct, origins, opts.FieldRenames)
+			if len(conflicts) > 0 {
+				return nil, fmt.Errorf("%s has conflicting cty names:\n%s", id.Name, strings.Join(conflicts, "\n"))
+			}
+			if opts.Strict && len(dups) > 0 {
+				return nil, fmt.Errorf("%s has duplicate cty names:\n%s", id.Name, strings.Join(dups, "\n"))
+			}
+			flatenedStruct = addCtyTagToStruct(flatenedStruct, id.Name, origins, opts)
+			if opts.EmitHCLTags {
+				flatenedStruct = addHCLTagToStruct(flatenedStruct)
+			}
+			newStructName := flatName(id.Name, opts)
+			flatenedStruct, hoisted, err := hoistAnonymousStructs(obj.Pkg(), newStructName, flatenedStruct, opts)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", id.Name, err)
+			}
+			defs := append([]StructDef{{
+				OriginalStructName: id.Name,
+				StructName:         newStructName,
+				Struct:             flatenedStruct,
+				MergedSpecs:        merged,
+			}}, hoisted...)
+			if opts.Annotate {
+				goTypes := map[token.Pos]string{}
+				fieldGoTypes(obj.Pkg(), utStruct, goTypes)
+				for i := range defs {
+					defs[i].goTypes = goTypes
+				}
+			}
+			structs = append(structs, defs...)
+
+			for _, def := range defs {
+				imports := getUsedImports(def.Struct)
+				for _, t := range def.MergedSpecs {
+					addUsedImports(imports, t)
+				}
+				for k, v := range imports {
+					if _, found := usedImports[k]; !found {
+						usedImports[k] = v
+					}
+				}
+			}
+		}
+		if !opts.IncludeNested {
+			break
+		}
+		nested := nestedTypeNames(topPkg.Types, structs[generated:], requested, opts)
+		if len(nested) == 0 {
+			break
+		}
+		typeNames = append(typeNames, nested...)
+		sort.Strings(typeNames)
+	}
+
+	if len(typeNames) > 0 {
+		// the found types were removed from typeNames.
+		if opts.Strict {
+			return nil, fmt.Errorf("type(s) not found in %s: %s", topPkg.PkgPath, strings.Join(typeNames, ", "))
+		}
+		logf(opts.log, token.NoPos, "warning: type(s) not found in %s: %s", topPkg.PkgPath, strings.Join(typeNames, ", "))
+	}
+
+	if opts.PackageName == "" || opts.PackageName == topPkg.Name {
+		// the Flat structs of a previous generation are replaced, but
+		// hand-written ones would be redeclared.
+		generated := generatedFiles(topPkg)
+		for _, def := range structs {
+			obj := topPkg.Types.Scope().Lookup(def.StructName)
+			if obj == nil {
+				continue
+			}
+			if p := topPkg.Fset.Position(obj.Pos()); !generated[p.Filename] {
+				return nil, fmt.Errorf("%s:%d: %s is already declared, the Flat struct of %s would redeclare it; rename it or use -trimprefix", p.Filename, p.Line, def.StructName, def.OriginalStructName)
+			}
+		}
+	}
+
+	if opts.List {
+		return listStructs(structs), nil
+	}
+	if opts.Description != nil {
+		*opts.Description = describeStructs(structs)
+	}
+
+	out := generateCode(opts, topPkg.Name, topPkg.PkgPath, structs, usedImports)
+	if opts.NoFallback {
+		if n := bytes.Count(out, []byte(typeNotFoundMarker)); n > 0 {
+			return nil, fmt.Errorf("could not find the type of %d field(s), look for %q in the generated code", n, typeNotFoundMarker)
+		}
+	}
+	return out, nil
+}
+
+// generatedMarker matches the comment marking generated files, see
+// https://golang.org/s/generatedcode.
+var generatedMarker = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// generatedFiles returns the names of the files of pkg that have the
+// generatedMarker before their package clause.
+func generatedFiles(pkg *packages.Package) map[string]bool {
+	generated := map[string]bool{}
+	for _, f := range pkg.Syntax {
+		for _, group := range f.Comments {
+			if group.Pos() > f.Package {
+				break
+			}
+			for _, c := range group.List {
+				if generatedMarker.MatchString(c.Text) {
+					generated[pkg.Fset.Position(f.Pos()).Filename] = true
+				}
+			}
+		}
+	}
+	return generated
+}
+
+// configTypeNames returns the names of the config-like types of pkg, see
+// Options.All. Generic types are left out, see isGeneric.
+func configTypeNames(pkg *packages.Package) []string {
+	generated := generatedFiles(pkg)
+	var names []string
+	scope := pkg.Types.Scope()
+	for _, name := range scope.Names() {
+		obj, isTypeName := scope.Lookup(name).(*types.TypeName)
+		if !isTypeName || !obj.Exported() || obj.IsAlias() || generated[pkg.Fset.Position(obj.Pos()).Filename] {
+			continue
+		}
+		s, isStruct := obj.Type().Underlying().(*types.Struct)
+		if named, isNamed := obj.Type().(*types.Named); !isStruct || isNamed && isGeneric(named) {
+			continue
+		}
+		for i := 0; i < s.NumFields(); i++ {
+			if tags, err := parseTag(s.Tag(i)); err == nil {
+				if _, err := tags.Get("mapstructure"); err == nil {
+					names = append(names, name)
+					break
+				}
+			}
+		}
+	}
+	return names
+}
+
+// implementingTypeNames returns the names of the struct types of pkg that
+// implement the marker interface ref, see Options.Implementing. Like with
+// configTypeNames, the types of the generated files and the generic ones are
+// left out.
+func implementingTypeNames(pkg *packages.Package, ref string) ([]string, error) {
+	iface, err := markerInterface(pkg.Types, ref)
+	if err != nil {
+		return nil, err
+	}
+	generated := generatedFiles(pkg)
+	var names []string
+	scope := pkg.Types.Scope()
+	for _, name := range scope.Names() {
+		obj, isTypeName := scope.Lookup(name).(*types.TypeName)
+		if !isTypeName || obj.IsAlias() || generated[pkg.Fset.Position(obj.Pos()).Filename] {
+			continue
+		}
+		named, isNamed := obj.Type().(*types.Named)
+		if !isNamed || isGeneric(named) {
+			continue
+		}
+		if _, isStruct := named.Underlying().(*types.Struct); !isStruct {
+			continue
+		}
+		if types.Implements(named, iface) || types.Implements(types.NewPointer(named), iface) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// markerInterface returns the interface referenced by ref, the name of an
+// interface of topPkg or the fully qualified name of one of its imports.
+func markerInterface(topPkg *types.Package, ref string) (*types.Interface, error) {
+	var t types.Type
+	if token.IsIdentifier(ref) {
+		obj, isTypeName := topPkg.Scope().Lookup(ref).(*types.TypeName)
+		if !isTypeName {
+			return nil, fmt.Errorf("marker interface %s not found in %s", ref, topPkg.Path())
+		}
+		t = obj.Type()
+	} else {
+		var err error
+		if t, err = lookupImpl(topPkg, ref); err != nil {
+			return nil, fmt.Errorf("marker interface: %v", err)
+		}
+	}
+	iface, isInterface := t.Underlying().(*types.Interface)
+	if !isInterface {
+		return nil, fmt.Errorf("marker %s is not an interface", ref)
+	}
+	return iface, nil
+}
+
+// StructDef is a Flat struct to generate. OriginalStructName is empty for
+// the structs hoisted from an anonymous struct field.
+type StructDef struct {
+	OriginalStructName string
+	StructName         string
+	Struct             *types.Struct
+	// MergedSpecs are the squashed types with a self-defined HCL2Spec,
+	// whose spec is merged into the HCL2Spec of the Flat struct.
+	MergedSpecs []*types.Named
+	// goTypes are the original Go types of the fields, keyed by their
+	// position, see Options.Annotate.
+	goTypes map[token.Pos]string
+}
+
+// generateCode returns the formatted code of the pkgName package that
+// defines structs.
+func generateCode(opts Options, pkgName, pkgPath string, structs []StructDef, usedImports map[NamePath]*types.Package) []byte {
+	out := bytes.NewBuffer(nil)
+
+	header := commentHeader(opts.Header)
+	if header != "" && opts.HeaderBeforeMarker {
+		fmt.Fprintf(out, "%s\n\n", header)
+	}
+	fmt.Fprintf(out, `// Code generated by "mapstructure-to-hcl2 %s"; DO NOT EDIT.`, opts.CommandLine)
+	if header != "" && !opts.HeaderBeforeMarker {
+		// not attached to the package clause, so that it is not its doc.
+		fmt.Fprintf(out, "\n\n%s\n", header)
+	}
+	// local tells whether the code is generated in the package of the
+	// original structs.
+	local := opts.PackageName == "" || opts.PackageName == pkgName
+	if local {
+		fmt.Fprintf(out, "\npackage %s\n", pkgName)
+	} else {
+		fmt.Fprintf(out, "\npackage %s\n", opts.PackageName)
+	}
+
+	sort.Slice(structs, func(i int, j int) bool {
+		return structs[i].StructName < structs[j].StructName
+	})
+	var previous map[string][]byte
+	if opts.OnlyChanged {
+		previous = splitSections(opts.Previous)
+	}
+	// the Flat structs of this file, whose methods can be called on their
+	// fields.
+	generated := map[string]bool{}
+	for _, def := range structs {
+		generated[def.StructName] = true
+	}
+	body := bytes.NewBuffer(nil)
+	for _, flatenedStruct := range structs {
+		hash := structHash(flatenedStruct, opts)
+		if section, found := previous[flatenedStruct.StructName]; found && opts.Manifest[flatenedStruct.StructName] == hash {
+			body.WriteString("\n")
+			body.Write(section)
+			continue
+		}
+		outputStructDef(body, flatenedStruct, local, opts)
+		if opts.KeepZeroValueDistinction {
+			outputFromCtyValue(body, flatenedStruct, pkgPath, generated)
+		}
+		if opts.ToCtyValue {
+			outputToCtyValue(body, flatenedStruct, opts, pkgPath, generated)
+		}
+		if opts.DecodeCtyValue {
+			outputDecodeCtyValue(body, flatenedStruct.StructName, opts)
+		}
+		if opts.EmitStringer {
+			outputStringer(body, flatenedStruct.StructName, flatenedStruct.Struct)
+		}
+		if opts.Manifest != nil {
+			opts.Manifest[flatenedStruct.StructName] = hash
+		}
+	}
+
+	if !local {
+		// the Flat structs are generated in this package.
+		body = bytes.NewBuffer(bytes.ReplaceAll(body.Bytes(), []byte(pkgPath+".Flat"), []byte("Flat")))
+	}
+	if local || !bytes.Contains(body.Bytes(), []byte(pkgPath+".")) {
+		delete(usedImports, NamePath{pkgName, pkgPath})
+	} else {
+		usedImports[NamePath{pkgName, pkgPath}] = types.NewPackage(pkgPath, pkgName)
+	}
+	usedImports[hcldecImport] = types.NewPackage(hcldecImport.Path, hcldecImport.Name)
+	if bytes.Contains(body.Bytes(), []byte("cty.")) {
+		// an empty struct has no attribute to type.
+		usedImports[ctyImport] = types.NewPackage(ctyImport.Path, ctyImport.Name)
+	}
+	if bytes.Contains(body.Bytes(), []byte("gocty.")) {
+		usedImports[goctyImport] = types.NewPackage(goctyImport.Path, goctyImport.Name)
+	}
+	if bytes.Contains(body.Bytes(), []byte("hcl.")) {
+		usedImports[hclImport] = types.NewPackage(hclImport.Path, hclImport.Name)
+	}
+	if opts.EmitStringer && len(structs) > 0 {
+		usedImports[fmtImport] = types.NewPackage(fmtImport.Path, fmtImport.Name)
+		usedImports[stringsImport] = types.NewPackage(stringsImport.Path, stringsImport.Name)
+	}
+	if bytes.Contains(body.Bytes(), []byte(configImport.Path+".")) {
+		usedImports[configImport] = types.NewPackage(configImport.Path, configImport.Name)
+	}
+	if opts.DecodeCtyValue && len(structs) > 0 {
+		usedImports[hclJSONImport] = types.NewPackage(hclJSONImport.Path, hclJSONImport.Name)
+		usedImports[ctyJSONImport] = types.NewPackage(ctyJSONImport.Path, ctyJSONImport.Name)
+	}
+	aliases := importAliases(usedImports)
+	outputImports(out, aliases)
+	out.Write(body.Bytes())
+
+	imports := make([]NamePath, 0, len(aliases))
+	for impt := range aliases {
+		imports = append(imports, impt)
+	}
+	// replace longer paths first so that a path can't partially replace
+	// another one.
+	sort.Slice(imports, func(i, j int) bool {
+		return len(imports[i].Path) > len(imports[j].Path)
+	})
+	for _, impt := range imports {
+		if strings.ContainsAny(impt.Path, "/") {
+			out = bytes.NewBuffer(bytes.ReplaceAll(out.Bytes(),
+				[]byte(impt.Path+"."),
+				[]byte(aliases[impt]+".")))
+		}
+	}
+
+	if local {
+		// avoid needing to import current pkg; there's probably a better way.
+		out = bytes.NewBuffer(bytes.ReplaceAll(out.Bytes(),
+			[]byte(pkgPath+"."),
+			nil))
+	}
+
+	return goFmt(out.Bytes(), opts.log)
+}
+
+// listStructs returns the summary of structs: their number of fields and
+// the fields whose type is not handled.
+func listStructs(structs []StructDef) []byte {
+	sort.Slice(structs, func(i int, j int) bool {
+		return structs[i].StructName < structs[j].StructName
+	})
+	out := bytes.NewBuffer(nil)
+	for _, def := range structs {
+		s := def.Struct
+		fmt.Fprintf(out, "%s: %d field(s)\n", def.StructName, s.NumFields())
+		for i := 0; i < s.NumFields(); i++ {
+			st, _ := parseTag(s.Tag(i))
+			ctyTag, _ := st.Get("cty")
+			spec := bytes.NewBuffer(nil)
+			outputHCL2SpecField(spec, ctyTag.Name, s.Field(i).Type(), st)
+			if bytes.Contains(spec.Bytes(), []byte(typeNotFoundMarker)) {
+				fmt.Fprintf(out, "\t%s: unhandled type %s\n", s.Field(i).Name(), s.Field(i).Type())
+			}
+		}
+	}
+	return out.Bytes()
+}
+
+// outputStructDef writes the Flat struct of flatenedStruct along with its
+// FlatMapstructure and HCL2Spec methods. FlatMapstructure is only written
+// when local, in the package of the original struct.
+func outputStructDef(out io.Writer, flatenedStruct StructDef, local bool, opts Options) {
+	if flatenedStruct.OriginalStructName == "" {
+		fmt.Fprintf(out, "\n// %s is an auto-generated flat version of an anonymous struct.", flatenedStruct.StructName)
+	} else {
+		fmt.Fprintf(out, "\n// %s is an auto-generated flat version of %s.", flatenedStruct.StructName, flatenedStruct.OriginalStructName)
+	}
+	fmt.Fprintf(out, "\n// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.")
+	fmt.Fprintf(out, "\ntype %s struct {\n", flatenedStruct.StructName)
+	outputStructFields(out, flatenedStruct.Struct)
+	if opts.CaptureRanges {
+		// without a cty tag, gocty leaves it alone.
+		fmt.Fprint(out, "HCL2Ranges map[string]hcl.Range `mapstructure:\"-\"`\n")
+	}
+	fmt.Fprint(out, "}\n")
+
+	if opts.Annotate {
+		outputAnnotations(out, flatenedStruct)
+	}
+
+	if local && flatenedStruct.OriginalStructName != "" {
+		outputFlatMapstructure(out, flatenedStruct)
+	}
+
+	fmt.Fprintf(out, "\n// HCL2Spec returns the hcldec.Spec of a %s.", flatenedStruct.StructName)
+	fmt.Fprintf(out, "\n// This spec is used by HCL to read the fields of %s.", flatenedStruct.StructName)
+	fmt.Fprintf(out, "\nfunc (*%s) HCL2Spec() map[string]hcldec.Spec {\n", flatenedStruct.StructName)
+	outputStructHCL2SpecBody(out, flatenedStruct.Struct, flatenedStruct.MergedSpecs...)
+	fmt.Fprint(out, "}\n")
+
+	if opts.CtyToFieldName {
+		outputCtyToFieldName(out, flatenedStruct)
+	}
+
+	outputValidate(out, flatenedStruct.StructName, flatenedStruct.Struct, opts.log)
+
+	outputDefaults(out, flatenedStruct.StructName, flatenedStruct.Struct)
+
+	if opts.CaptureRanges {
+		outputCaptureRanges(out, flatenedStruct.StructName)
+	}
+}
+
+// outputAnnotations writes the comment listing the Go type of each field of
+// a Flat struct, see Options.Annotate. It is followed by a blank line so
+// that it is not the doc of the next declaration.
+func outputAnnotations(out io.Writer, flatenedStruct StructDef) {
+	fmt.Fprintf(out, "\n// The attributes and blocks of %s come from these Go types:", flatenedStruct.StructName)
+	s := flatenedStruct.Struct
+	for i := 0; i < s.NumFields(); i++ {
+		st, _ := parseTag(s.Tag(i))
+		ctyTag, err := st.Get("cty")
+		goType, found := flatenedStruct.goTypes[s.Field(i).Pos()]
+		if err != nil || !found {
+			continue
+		}
+		fmt.Fprintf(out, "\n//   %s: %s", ctyTag.Name, goType)
+	}
+	fmt.Fprint(out, "\n\n")
+}
+
+// fieldGoTypes records the Go type of the fields of s, and of the fields of
+// the structs they squash, include or nest, keyed by their position. The
+// types of pkg are not qualified.
+func fieldGoTypes(pkg *types.Package, s *types.Struct, goTypes map[token.Pos]string) {
+	qualifier := func(p *types.Package) string {
+		if p == pkg {
+			return ""
+		}
+		return p.Name()
+	}
+	for i := 0; i < s.NumFields(); i++ {
+		field, tag := s.Field(i), s.Tag(i)
+		if _, seen := goTypes[field.Pos()]; seen {
+			// ex: a recursive type.
+			continue
+		}
+		goTypes[field.Pos()] = types.TypeString(field.Type(), qualifier)
+		if ref := includeRef(tag); ref != "" {
+			if included, err := lookupStruct(pkg, ref); err == nil {
+				fieldGoTypes(pkg, included, goTypes)
+			}
+			continue
+		}
+		t := field.Type()
+		if p, isPointer := t.(*types.Pointer); isPointer {
+			t = p.Elem()
+		}
+		if str, isStruct := t.Underlying().(*types.Struct); isStruct {
+			fieldGoTypes(pkg, str, goTypes)
+		}
+	}
+}
+
+// outputCaptureRanges writes the CaptureRanges method of a Flat struct
+// generated with a HCL2Ranges field.
+func outputCaptureRanges(w io.Writer, structName string) {
+	fmt.Fprintf(w, "\n// CaptureRanges sets the HCL2Ranges of a %s to the source range of each", structName)
+	fmt.Fprintf(w, "\n// attribute of body, keyed by their name.")
+	fmt.Fprintf(w, "\nfunc (c *%s) CaptureRanges(body hcl.Body) {\n", structName)
+	fmt.Fprint(w, "content, _, _ := body.PartialContent(hcldec.ImpliedSchema(hcldec.ObjectSpec(c.HCL2Spec())))\n")
+	fmt.Fprint(w, "c.HCL2Ranges = make(map[string]hcl.Range, len(content.Attributes))\n")
+	fmt.Fprint(w, "for name, attr := range content.Attributes {\n")
+	fmt.Fprint(w, "c.HCL2Ranges[name] = attr.Range\n")
+	fmt.Fprint(w, "}\n")
+	fmt.Fprint(w, "}\n")
+}
+
+// outputCtyToFieldName writes the CtyToFieldName method of a Flat struct,
+// mapping the cty name of each of its fields to the field name.
+func outputCtyToFieldName(out io.Writer, flatenedStruct StructDef) {
+	fmt.Fprintf(out, "\n// CtyToFieldName returns the name of the field of a %s for each", flatenedStruct.StructName)
+	fmt.Fprintf(out, "\n// of its cty attributes.")
+	fmt.Fprintf(out, "\nfunc (*%s) CtyToFieldName() map[string]string {\n", flatenedStruct.StructName)
+	fmt.Fprint(out, "return map[string]string{\n")
+	s := flatenedStruct.Struct
+	for i := 0; i < s.NumFields(); i++ {
+		st, _ := parseTag(s.Tag(i))
+		ctyTag, err := st.Get("cty")
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(out, "%q: %q,\n", ctyTag.Name, s.Field(i).Name())
+	}
+	fmt.Fprint(out, "}\n}\n")
+}
+
+func outputFlatMapstructure(out io.Writer, flatenedStruct StructDef) {
+	fmt.Fprintf(out, "\n// FlatMapstructure returns a new %s.", flatenedStruct.StructName)
+	fmt.Fprintf(out, "\n// %s is an auto-generated flat version of %s.", flatenedStruct.StructName, flatenedStruct.OriginalStructName)
+	fmt.Fprintf(out, "\n// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.")
+	fmt.Fprintf(out, "\nfunc (*%s) FlatMapstructure() interface{} {", flatenedStruct.OriginalStructName)
+	fmt.Fprintf(out, "return new(%s)", flatenedStruct.StructName)
+	fmt.Fprint(out, "}\n")
+}
+
+// nestedTypeNames returns the names of the struct types of pkg that the Flat
+// structs of defs refer to and that are not requested yet, ex: Nested for a
+// *FlatNested or a []FlatNested field. They are added to requested.
+func nestedTypeNames(pkg *types.Package, defs []StructDef, requested map[string]bool, opts Options) []string {
+	flatNames := map[string]string{}
+	for _, name := range pkg.Scope().Names() {
+		if tn, isTypeName := pkg.Scope().Lookup(name).(*types.TypeName); isTypeName {
+			if _, isStruct := tn.Type().Underlying().(*types.Struct); isStruct {
+				flatNames[flatName(name, opts)] = name
+			}
+		}
+	}
+	var nested []string
+	for _, def := range defs {
+		for i := 0; i < def.Struct.NumFields(); i++ {
+			t := def.Struct.Field(i).Type()
+			for {
+				switch container := t.(type) {
+				case *types.Pointer:
+					t = container.Elem()
+					continue
+				case *types.Slice:
+					t = container.Elem()
+					continue
+				case *types.Array:
+					t = container.Elem()
+					continue
+				}
+				break
+			}
+			named, isNamed := t.(*types.Named)
+			if !isNamed || named.Obj().Pkg() != pkg {
+				continue
+			}
+			name, found := flatNames[named.Obj().Name()]
+			if found && !requested[name] {
+				requested[name] = true
+				nested = append(nested, name)
+			}
+		}
+	}
+	return nested
+}
+
+// commentHeader returns header as Go comments, commenting out the lines that
+// are not comments already, ex: "SPDX-License-Identifier: MPL-2.0".
+func commentHeader(header string) string {
+	header = strings.TrimSpace(header)
+	if header == "" || strings.HasPrefix(header, "/*") {
+		return header
+	}
+	lines := strings.Split(header, "\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		switch {
+		case strings.HasPrefix(strings.TrimSpace(line), "//"):
+		case line == "":
+			line = "//"
+		default:
+			line = "// " + line
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// outputStringer writes the String method of a Flat struct, which shows the
+// value of the pointer fields or nil. The Flat structs it holds are shown
+// with their own String method when they have one.
+func outputStringer(w io.Writer, structName string, s *types.Struct) {
+	fmt.Fprintf(w, "\n// String returns a readable version of a %s, for debugging.", structName)
+	fmt.Fprintf(w, "\nfunc (c *%s) String() string {\n", structName)
+	fmt.Fprint(w, "if c == nil {\nreturn \"nil\"\n}\n")
+	fmt.Fprint(w, "var fields []string\n")
+	for i := 0; i < s.NumFields(); i++ {
+		name := s.Field(i).Name()
+		switch ft := s.Field(i).Type().(type) {
+		case *types.Pointer:
+			fmt.Fprintf(w, "if c.%s == nil {\nfields = append(fields, %q)\n} else {\n", name, name+": nil")
+			if isFlatStruct(ft.Elem()) {
+				fmt.Fprintf(w, "fields = append(fields, fmt.Sprintf(%q, c.%s))\n", name+": %v", name)
+			} else {
+				fmt.Fprintf(w, "fields = append(fields, fmt.Sprintf(%q, *c.%s))\n", name+": "+stringerVerb(ft.Elem()), name)
+			}
+			fmt.Fprint(w, "}\n")
+		case *types.Slice:
+			fmt.Fprintf(w, "if c.%s == nil {\nfields = append(fields, %q)\n} else {\n", name, name+": nil")
+			outputStringerList(w, name, ft.Elem())
+			fmt.Fprint(w, "}\n")
+		case *types.Array:
+			outputStringerList(w, name, ft.Elem())
+		case *types.Map:
+			fmt.Fprintf(w, "if c.%s == nil {\nfields = append(fields, %q)\n} else {\n", name, name+": nil")
+			fmt.Fprintf(w, "fields = append(fields, fmt.Sprintf(%q, c.%s))\n", name+": %v", name)
+			fmt.Fprint(w, "}\n")
+		default:
+			fmt.Fprintf(w, "fields = append(fields, fmt.Sprintf(%q, c.%s))\n", name+": "+stringerVerb(ft), name)
+		}
+	}
+	fmt.Fprintf(w, "return %q + strings.Join(fields, \", \") + \"}\"\n", structName+"{")
+	fmt.Fprint(w, "}\n")
+}
+
+// outputStringerList appends the items of the slice or array field name to
+// the fields of a String method.
+func outputStringerList(w io.Writer, name string, elem types.Type) {
+	if !isFlatStruct(elem) {
+		fmt.Fprintf(w, "fields = append(fields, fmt.Sprintf(%q, c.%s))\n", name+": "+stringerVerb(types.NewSlice(elem)), name)
+		return
+	}
+	fmt.Fprintf(w, "items := make([]string, len(c.%s))\n", name)
+	fmt.Fprintf(w, "for i := range c.%s {\n", name)
+	fmt.Fprintf(w, "items[i] = fmt.Sprint(&c.%s[i])\n}\n", name)
+	fmt.Fprintf(w, "fields = append(fields, %q+strings.Join(items, \", \")+\"]\")\n", name+": [")
+}
+
+// isFlatStruct tells whether t is a Flat struct, ex: the FlatNested of a
+// Nested field.
+func isFlatStruct(t types.Type) bool {
+	named, isNamed := t.(*types.Named)
+	if !isNamed || named.String() == ctyValue.String() {
+		return false
+	}
+	if _, isNullable := nullableValue(named); isNullable {
+		return false
+	}
+	_, isStruct := named.Underlying().(*types.Struct)
+	return isStruct
+}
+
+// stringerVerb returns the fmt verb showing a value of t in a String method:
+// strings are quoted and cty values are shown with their GoString.
+func stringerVerb(t types.Type) string {
+	if t.String() == ctyValue.String() {
+		return "%#v"
+	}
+	if slice, isSlice := t.Underlying().(*types.Slice); isSlice {
+		t = slice.Elem()
+	}
+	if b, isBasic := t.Underlying().(*types.Basic); isBasic && b.Info()&types.IsString != 0 {
+		return "%q"
+	}
+	return "%v"
+}
+
+// outputDecodeCtyValue writes the DecodeCtyValue method of a Flat struct.
+// The value is written as JSON and decoded with the JSON syntax of HCL, so
+// that it is decoded exactly like a body: its null and missing attributes
+// are left unset and its unknown ones are errors.
+func outputDecodeCtyValue(w io.Writer, structName string, opts Options) {
+	fmt.Fprintf(w, "\n// DecodeCtyValue returns the %s that val, a cty object value, decodes to", structName)
+	fmt.Fprintf(w, "\n// with its HCL2Spec, like the body of a block, ex: to build one in a test.")
+	fmt.Fprintf(w, "\n// The values are not checked like the decode layer does.")
+	fmt.Fprintf(w, "\nfunc (*%s) DecodeCtyValue(val cty.Value) (*%s, error) {\n", structName, structName)
+	fmt.Fprintf(w, "b, err := %s.Marshal(val, val.Type())\n", ctyJSONImport.Path)
+	fmt.Fprint(w, "if err != nil {\nreturn nil, err\n}\n")
+	fmt.Fprintf(w, "f, diags := %s.Parse(b, %q)\n", hclJSONImport.Path, structName)
+	fmt.Fprint(w, "if diags.HasErrors() {\nreturn nil, diags\n}\n")
+	fmt.Fprintf(w, "c := new(%s)\n", structName)
+	fmt.Fprint(w, "v, diags := hcldec.Decode(f.Body, hcldec.ObjectSpec(c.HCL2Spec()), nil)\n")
+	fmt.Fprint(w, "if diags.HasErrors() {\nreturn nil, diags\n}\n")
+	// like the decode layer, the base64 attributes are decoded first.
+	if opts.KeepZeroValueDistinction {
+		fmt.Fprintf(w, "if v, err = %s.DecodeBase64Attributes(v, c); err != nil {\nreturn nil, err\n}\n", configImport.Path)
+		fmt.Fprint(w, "return c, c.FromCtyValue(v)\n")
+	} else {
+		fmt.Fprintf(w, "return c, %s.FromCtyValue(v, c)\n", configImport.Path)
+	}
+	fmt.Fprint(w, "}\n")
+}
+
+// outputToCtyValue writes the ToCtyValue method of a Flat struct, the
+// inverse of decoding a body with its HCL2Spec. When opts.EmptySlicesAsNull
+// is set, the empty lists of the value are made null.
+func outputToCtyValue(w io.Writer, def StructDef, opts Options, pkgPath string, generated map[string]bool) {
+	structName := def.StructName
+	fmt.Fprintf(w, "\n// ToCtyValue returns the cty object value of a %s, typed after its", structName)
+	if opts.EmptySlicesAsNull {
+		fmt.Fprintf(w, "\n// HCL2Spec. Nil fields and empty slices are null.")
+	} else {
+		fmt.Fprintf(w, "\n// HCL2Spec. Nil fields are null.")
+	}
+	fmt.Fprintf(w, "\nfunc (c *%s) ToCtyValue() (cty.Value, error) {\n", structName)
+	switch {
+	case opts.KeepZeroValueDistinction:
+		// gocty can't convert the Nullable fields.
+		outputFieldsToCtyValue(w, def.Struct, pkgPath, generated)
+		if !opts.EmptySlicesAsNull {
+			fmt.Fprint(w, "return v, nil\n")
+			fmt.Fprint(w, "}\n")
+			return
+		}
+	case !opts.EmptySlicesAsNull:
+		// unlike gocty, this encodes the base64 fields.
+		fmt.Fprintf(w, "return %s.ToCtyValue(c, hcldec.ImpliedType(hcldec.ObjectSpec(c.HCL2Spec())))\n", configImport.Path)
+		fmt.Fprint(w, "}\n")
+		return
+	default:
+		fmt.Fprintf(w, "v, err := %s.ToCtyValue(c, hcldec.ImpliedType(hcldec.ObjectSpec(c.HCL2Spec())))\n", configImport.Path)
+		fmt.Fprint(w, "if err != nil {\nreturn v, err\n}\n")
+	}
+	fmt.Fprint(w, "return cty.Transform(v, func(_ cty.Path, v cty.Value) (cty.Value, error) {\n")
+	fmt.Fprint(w, "if v.Type().IsListType() && v.IsKnown() && !v.IsNull() && v.LengthInt() == 0 {\n")
+	fmt.Fprint(w, "return cty.NullVal(v.Type()), nil\n")
+	fmt.Fprint(w, "}\n")
+	fmt.Fprint(w, "return v, nil\n")
+	fmt.Fprint(w, "})\n")
+	fmt.Fprint(w, "}\n")
+}
+
+// outputFieldsToCtyValue writes the code converting the fields of s one by
+// one into the object value v: the Nullable fields and the Flat structs of
+// generated convert themselves, gocty converts the others. The base64 fields
+// are converted to lists of bytes, then encoded.
+func outputFieldsToCtyValue(w io.Writer, s *types.Struct, pkgPath string, generated map[string]bool) {
+	encoded := false
+	fmt.Fprint(w, "ty := hcldec.ImpliedType(hcldec.ObjectSpec(c.HCL2Spec()))\n")
+	fmt.Fprint(w, "attrs := map[string]cty.Value{}\n")
+	// the attributes of the merged specs have no field.
+	fmt.Fprint(w, "for name, t := range ty.AttributeTypes() {\nattrs[name] = cty.NullVal(t)\n}\n")
+	for i := 0; i < s.NumFields(); i++ {
+		field := s.Field(i)
+		st, _ := parseTag(s.Tag(i))
+		ctyTag, err := st.Get("cty")
+		if err != nil {
+			continue
+		}
+		name, path := ctyTag.Name, fmt.Sprintf("cty.GetAttrPath(%q)", ctyTag.Name)
+		if _, isNullable := nullableValue(field.Type()); isNullable {
+			fmt.Fprintf(w, "if ty.HasAttribute(%q) {\nattrs[%q] = c.%s.CtyValue()\n}\n", name, name, field.Name())
+			continue
+		}
+		switch ft := field.Type().(type) {
+		case *types.Pointer:
+			if isGeneratedFlat(ft.Elem(), pkgPath, generated) {
+				fmt.Fprintf(w, "if ty.HasAttribute(%q) && c.%s != nil {\n", name, field.Name())
+				fmt.Fprintf(w, "v, err := c.%s.ToCtyValue()\n", field.Name())
+				fmt.Fprintf(w, "if err != nil {\nreturn cty.DynamicVal, %s.NewError(err)\n}\n", path)
+				fmt.Fprintf(w, "attrs[%q] = v\n}\n", name)
+				continue
+			}
+		case *types.Slice:
+			if isGeneratedFlat(ft.Elem(), pkgPath, generated) {
+				fmt.Fprintf(w, "if ty.HasAttribute(%q) && c.%s != nil {\n", name, field.Name())
+				fmt.Fprintf(w, "items := make([]cty.Value, len(c.%s))\n", field.Name())
+				fmt.Fprintf(w, "for i := range c.%s {\n", field.Name())
+				fmt.Fprintf(w, "v, err := c.%s[i].ToCtyValue()\n", field.Name())
+				fmt.Fprintf(w, "if err != nil {\nreturn cty.DynamicVal, %s.Index(cty.NumberIntVal(int64(i))).NewError(err)\n}\n", path)
+				fmt.Fprint(w, "items[i] = v\n}\n")
+				fmt.Fprintf(w, "if len(items) == 0 {\nattrs[%q] = cty.ListValEmpty(ty.AttributeType(%q).ElementType())\n", name, name)
+				fmt.Fprintf(w, "} else {\nattrs[%q] = cty.ListVal(items)\n}\n}\n", name)
+				continue
+			}
+		}
+		fmt.Fprintf(w, "if ty.HasAttribute(%q) {\n", name)
+		if enc, err := st.Get("hcl2encoding"); err == nil && enc.Name == "base64" {
+			encoded = true
+			fmt.Fprintf(w, "v, err := gocty.ToCtyValue(c.%s, cty.List(cty.Number))\n", field.Name())
+		} else {
+			fmt.Fprintf(w, "v, err := gocty.ToCtyValue(c.%s, ty.AttributeType(%q))\n", field.Name(), name)
+		}
+		fmt.Fprintf(w, "if err != nil {\nreturn cty.DynamicVal, %s.NewError(err)\n}\n", path)
+		fmt.Fprintf(w, "attrs[%q] = v\n}\n", name)
+	}
+	if !encoded {
+		fmt.Fprint(w, "v := cty.ObjectVal(attrs)\n")
+		return
+	}
+	fmt.Fprintf(w, "v, err := %s.EncodeBase64Attributes(cty.ObjectVal(attrs), c)\n", configImport.Path)
+	fmt.Fprint(w, "if err != nil {\nreturn v, err\n}\n")
+}
+
+// outputFromCtyValue writes the FromCtyValue method of a Flat struct
+// generated with Options.KeepZeroValueDistinction, setting its fields from
+// the value decoded with its HCL2Spec like gocty.FromCtyValue does: the
+// Nullable fields and the Flat structs of generated set themselves, gocty
+// sets the others.
+func outputFromCtyValue(w io.Writer, def StructDef, pkgPath string, generated map[string]bool) {
+	s := def.Struct
+	fmt.Fprintf(w, "\n// FromCtyValue sets the fields of a %s from the cty object value decoded", def.StructName)
+	fmt.Fprintf(w, "\n// with its HCL2Spec. Its Nullable fields tell whether they were set.")
+	fmt.Fprintf(w, "\nfunc (c *%s) FromCtyValue(val cty.Value) error {\n", def.StructName)
+	fmt.Fprint(w, "if val.IsNull() {\nreturn nil\n}\n")
+	fmt.Fprint(w, "if !val.IsKnown() {\nreturn cty.Path(nil).NewErrorf(\"value must be known\")\n}\n")
+	// an empty struct, ex: a presence toggle block, has no field to set.
+	fields := bytes.NewBuffer(nil)
+	for i := 0; i < s.NumFields(); i++ {
+		field := s.Field(i)
+		st, _ := parseTag(s.Tag(i))
+		ctyTag, err := st.Get("cty")
+		if err != nil {
+			continue
+		}
+		name, path := ctyTag.Name, fmt.Sprintf("cty.GetAttrPath(%q)", ctyTag.Name)
+		fmt.Fprintf(fields, "if ty.HasAttribute(%q) {\n", name)
+		switch ft := field.Type().(type) {
+		case *types.Pointer:
+			if isGeneratedFlat(ft.Elem(), pkgPath, generated) {
+				fmt.Fprintf(fields, "c.%s = nil\n", field.Name())
+				fmt.Fprintf(fields, "if v := val.GetAttr(%q); !v.IsNull() {\n", name)
+				fmt.Fprintf(fields, "c.%s = new(%s)\n", field.Name(), ft.Elem())
+				fmt.Fprintf(fields, "if err := c.%s.FromCtyValue(v); err != nil {\nreturn %s.NewError(err)\n}\n", field.Name(), path)
+				fmt.Fprint(fields, "}\n}\n")
+				continue
+			}
+		case *types.Slice:
+			if isGeneratedFlat(ft.Elem(), pkgPath, generated) {
+				fmt.Fprintf(fields, "c.%s = nil\n", field.Name())
+				fmt.Fprintf(fields, "if v := val.GetAttr(%q); !v.IsNull() {\n", name)
+				fmt.Fprintf(fields, "if !v.IsKnown() {\nreturn %s.NewErrorf(\"value must be known\")\n}\n", path)
+				fmt.Fprintf(fields, "c.%s = make([]%s, v.LengthInt())\n", field.Name(), ft.Elem())
+				fmt.Fprint(fields, "for i, it := 0, v.ElementIterator(); it.Next(); i++ {\n")
+				fmt.Fprint(fields, "_, item := it.Element()\n")
+				fmt.Fprintf(fields, "if err := c.%s[i].FromCtyValue(item); err != nil {\n", field.Name())
+				fmt.Fprintf(fields, "return %s.Index(cty.NumberIntVal(int64(i))).NewError(err)\n}\n", path)
+				fmt.Fprint(fields, "}\n}\n}\n")
+				continue
+			}
+		}
+		if _, isNullable := nullableValue(field.Type()); isNullable {
+			fmt.Fprintf(fields, "if err := c.%s.FromCtyValue(val.GetAttr(%q)); err != nil {\n", field.Name(), name)
+		} else {
+			fmt.Fprintf(fields, "if err := gocty.FromCtyValue(val.GetAttr(%q), &c.%s); err != nil {\n", name, field.Name())
+		}
+		fmt.Fprintf(fields, "return %s.NewError(err)\n}\n}\n", path)
+	}
+	if fields.Len() > 0 {
+		fmt.Fprint(w, "ty := val.Type()\n")
+		fields.WriteTo(w)
+	}
+	fmt.Fprint(w, "return nil\n")
+	fmt.Fprint(w, "}\n")
+}
+
+// isGeneratedFlat tells whether t is one of the Flat structs generated in
+// the same file, whose methods can be called.
+func isGeneratedFlat(t types.Type, pkgPath string, generated map[string]bool) bool {
+	named, isNamed := t.(*types.Named)
+	if !isNamed || !isFlatStruct(named) || named.Obj().Pkg() == nil {
+		return false
+	}
+	return named.Obj().Pkg().Path() == pkgPath && generated[named.Obj().Name()]
+}
+
+// outputValidate writes the Validate method of a Flat struct when some of
+// its numbers are bounded with a `mapstructure:"port,min=1,max=65535"` tag or
+// some of its slices must not hold duplicates with a
+// `mapstructure:"ids,unique"` tag.
+func outputValidate(w io.Writer, structName string, s *types.Struct, l *logger) {
+	checks := bytes.NewBuffer(nil)
+	for i := 0; i < s.NumFields(); i++ {
+		field, tag := s.Field(i), s.Tag(i)
+		st, err := parseTag(tag)
+		if err != nil {
+			continue
+		}
+		ms, err := st.Get("mapstructure")
+		if err != nil {
+			continue
+		}
+		if ms.HasOption("unique") {
+			outputUniqueCheck(checks, structName, field, st, l)
+			continue
+		}
+		min, max := tagOptionValue(ms, "min"), tagOptionValue(ms, "max")
+		if min == "" && max == "" {
+			continue
+		}
+		ctyTag, _ := st.Get("cty")
+		value, guard := "c."+field.Name(), ""
+		fieldType := field.Type()
+		if p, isPointer := fieldType.(*types.Pointer); isPointer {
+			fieldType = p.Elem()
+			value, guard = "*"+value, value+" != nil"
+		}
+		if b, isNullable := nullableValue(fieldType); isNullable {
+			fieldType = b
+			value, guard = value+".Value", value+".IsSet"
+		}
+		if b, isBasic := fieldType.Underlying().(*types.Basic); !isBasic || b.Info()&types.IsNumeric == 0 {
+			logf(l, field.Pos(), "ignoring min/max of non numeric field %s.%s", structName, field.Name())
+			continue
+		}
+		var conds, detail []string
+		for _, bound := range []struct{ value, op, text string }{
+			{min, "<", "at least"},
+			{max, ">", "at most"},
+		} {
+			if bound.value == "" {
+				continue
+			}
+			if _, err := strconv.ParseFloat(bound.value, 64); err != nil {
+				logf(l, field.Pos(), "ignoring invalid bound %q of field %s.%s", bound.value, structName, field.Name())
+				continue
+			}
+			conds = append(conds, fmt.Sprintf("%s %s %s", value, bound.op, bound.value))
+			detail = append(detail, bound.text+" "+bound.value)
+		}
+		if len(conds) == 0 {
+			continue
+		}
+		cond := strings.Join(conds, " || ")
+		if guard != "" {
+			cond = fmt.Sprintf("%s && (%s)", guard, cond)
+		}
+		fmt.Fprintf(checks, "if %s {\n", cond)
+		fmt.Fprintf(checks, "diags = append(diags, &hcl.Diagnostic{\n")
+		fmt.Fprintf(checks, "Severity: hcl.DiagError,\n")
+		fmt.Fprintf(checks, "Summary: %q,\n", "Invalid "+ctyTag.Name)
+		fmt.Fprintf(checks, "Detail: %q,\n", ctyTag.Name+" must be "+strings.Join(detail, " and "))
+		fmt.Fprintf(checks, "})\n}\n")
+	}
+	if checks.Len() == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n// Validate checks that the decoded values of a %s match the constraints of", structName)
+	fmt.Fprintf(w, "\n// their tags.")
+	fmt.Fprintf(w, "\nfunc (c *%s) Validate() hcl.Diagnostics {\n", structName)
+	fmt.Fprintf(w, "var diags hcl.Diagnostics\n")
+	checks.WriteTo(w)
+	fmt.Fprintf(w, "return diags\n}\n")
+}
+
+// outputDefaults writes the Defaults and ApplyDefaults methods of a Flat
+// struct when some of its fields have a `mapstructure:"port,default=22"` or a
+// `default:"22"` tag.
+func outputDefaults(w io.Writer, structName string, s *types.Struct) {
+	values := bytes.NewBuffer(nil)
+	applied := bytes.NewBuffer(nil)
+	for i := 0; i < s.NumFields(); i++ {
+		field, tag := s.Field(i), s.Tag(i)
+		st, err := parseTag(tag)
+		if err != nil {
+			continue
+		}
+		def, err := st.Get("hcl2default")
+		if err != nil {
+			continue
+		}
+		ctyTag, _ := st.Get("cty")
+		fieldType := field.Type()
+		if p, isPointer := fieldType.(*types.Pointer); isPointer {
+			fieldType = p.Elem()
+		}
+		value, isNullable := nullableValue(fieldType)
+		if isNullable {
+			fieldType = value
+		}
+		b, _ := fieldType.Underlying().(*types.Basic)
+		literal := def.Value()
+		switch {
+		case b == nil:
+			continue
+		case b.Info()&types.IsBoolean != 0:
+			fmt.Fprintf(values, "%q: cty.BoolVal(%s),\n", ctyTag.Name, def.Value())
+		case b.Info()&types.IsNumeric != 0:
+			fmt.Fprintf(values, "%q: cty.MustParseNumberVal(%q),\n", ctyTag.Name, def.Value())
+		default:
+			fmt.Fprintf(values, "%q: cty.StringVal(%q),\n", ctyTag.Name, def.Value())
+			literal = strconv.Quote(def.Value())
+		}
+		if isNullable {
+			fmt.Fprintf(applied, "if !c.%s.IsSet {\n", field.Name())
+			fmt.Fprintf(applied, "c.%s = %s{Value: %s, IsSet: true}\n}\n", field.Name(), field.Type(), literal)
+		}
+		if _, isPointer := field.Type().(*types.Pointer); isPointer {
+			// an unset pointer field is nil; the non pointer ones are
+			// required.
+			fmt.Fprintf(applied, "if c.%s == nil {\n", field.Name())
+			fmt.Fprintf(applied, "v := %s(%s)\n", fieldType, literal)
+			fmt.Fprintf(applied, "c.%s = &v\n}\n", field.Name())
+		}
+	}
+	if values.Len() == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n// Defaults returns the default value of the attributes of a %s that have", structName)
+	fmt.Fprintf(w, "\n// one, keyed by their name.")
+	fmt.Fprintf(w, "\nfunc (*%s) Defaults() map[string]cty.Value {\n", structName)
+	fmt.Fprintf(w, "return map[string]cty.Value{\n")
+	values.WriteTo(w)
+	fmt.Fprintf(w, "}\n}\n")
+
+	if applied.Len() == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n// ApplyDefaults sets the fields of a %s that are not set to their", structName)
+	fmt.Fprintf(w, "\n// default value.")
+	fmt.Fprintf(w, "\nfunc (c *%s) ApplyDefaults() {\n", structName)
+	applied.WriteTo(w)
+	fmt.Fprintf(w, "}\n")
+}
+
+// outputUniqueCheck writes the check erroring when the slice field holds a
+// value more than once.
+func outputUniqueCheck(w io.Writer, structName string, field *types.Var, st *structtag.Tags, l *logger) {
+	slice, isSlice := field.Type().Underlying().(*types.Slice)
+	if !isSlice {
+		logf(l, field.Pos(), "ignoring unique option of non slice field %s.%s", structName, field.Name())
+		return
+	}
+	if !types.Comparable(slice.Elem()) {
+		logf(l, field.Pos(), "ignoring unique option of field %s.%s: %s values can't be compared", structName, field.Name(), slice.Elem())
+		return
+	}
+	ctyTag, _ := st.Get("cty")
+	fmt.Fprintf(w, "seen%s := map[interface{}]bool{}\n", field.Name())
+	fmt.Fprintf(w, "for _, v := range c.%s {\n", field.Name())
+	fmt.Fprintf(w, "if seen%s[v] {\n", field.Name())
+	fmt.Fprintf(w, "diags = append(diags, &hcl.Diagnostic{\n")
+	fmt.Fprintf(w, "Severity: hcl.DiagError,\n")
+	fmt.Fprintf(w, "Summary: %q,\n", "Invalid "+ctyTag.Name)
+	fmt.Fprintf(w, "Detail: %q,\n", ctyTag.Name+" must not contain duplicate values")
+	fmt.Fprintf(w, "})\nbreak\n}\n")
+	fmt.Fprintf(w, "seen%s[v] = true\n}\n", field.Name())
+}
+
+// defaultTagValue returns the default value of a field, set either with a
+// `mapstructure:"x,default=v"` option or with a `default:"v"` tag.
+func defaultTagValue(tags *structtag.Tags) string {
+	if tags == nil {
+		return ""
+	}
+	if ms, err := tags.Get("mapstructure"); err == nil {
+		if def := tagOptionValue(ms, "default"); def != "" {
+			return def
+		}
+	}
+	if def, err := tags.Get("default"); err == nil {
+		return def.Value()
+	}
+	return ""
+}
+
+// tagOptionValue returns the value of the `key=value` option of tag.
+func tagOptionValue(tag *structtag.Tag, key string) string {
+	for _, opt := range tag.Options {
+		if strings.HasPrefix(opt, key+"=") {
+			return strings.TrimPrefix(opt, key+"=")
+		}
+	}
+	return ""
+}
+
+// generatorTag is the struct tag key holding the options of this generator.
+// ex: `mapstructure-to-hcl2:",output-only"` or `mapstructure-to-hcl2:",label"`
+const generatorTag = "mapstructure-to-hcl2"
+
+// outputStructHCL2SpecBody writes the body of the HCL2Spec method of s, the
+// specs of merged override the ones of the fields of s.
+func outputStructHCL2SpecBody(w io.Writer, s *types.Struct, merged ...*types.Named) {
+	if s.NumFields() == 0 {
+		fmt.Fprintln(w, `s := map[string]hcldec.Spec{}`)
+		outputMergedSpecs(w, merged)
+		fmt.Fprintln(w, `return s`)
+		return
+	}
+	fmt.Fprintf(w, "s := map[string]hcldec.Spec{\n")
+
+	// the entries are sorted by name so that reordering fields doesn't
+	// change the generated code, but the label indexes follow the fields.
+	type entry struct{ name, spec string }
+	var entries []entry
+	labels := 0
+	for i := 0; i < s.NumFields(); i++ {
+		field, tag := s.Field(i), s.Tag(i)
+		st, _ := parseTag(tag)
+		if m2h, err := st.Get(generatorTag); err == nil && m2h.HasOption("output-only") {
+			// ex: an artifact, it is still decoded into the Flat struct but
+			// can't be set from HCL.
+			continue
+		}
+		ctyTag, _ := st.Get("cty")
+		spec := bytes.NewBuffer(nil)
+		if m2h, err := st.Get(generatorTag); err == nil && m2h.HasOption("label") {
+			// ex: the "shell" of `provisioner "shell" {}`. The enclosing
+			// block spec finds the label specs of its nested spec.
+			fmt.Fprintf(spec, "&hcldec.BlockLabelSpec{Index: %d, Name: %q}", labels, ctyTag.Name)
+			labels++
+		} else if b, isBasic := field.Type().Underlying().(*types.Basic); isBasic {
+			// only the required basic fields are not pointers, see
+			// Options.RequiredFromNonPointer.
+			fmt.Fprintf(spec, `%#v`, &hcldec.AttrSpec{
+				Name:     ctyTag.Name,
+				Type:     basicKindToCtyType(b.Kind()),
+				Required: true,
+			})
+		} else {
+			outputHCL2SpecField(spec, ctyTag.Name, field.Type(), st)
+		}
+		entries = append(entries, entry{ctyTag.Name, spec.String()})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].name < entries[j].name
+	})
+	for _, e := range entries {
+		fmt.Fprintf(w, "	\"%s\": %s,\n", e.name, e.spec)
+	}
+
+	fmt.Fprintln(w, `}`)
+	outputMergedSpecs(w, merged)
+	fmt.Fprintln(w, `return s`)
+}
+
+// outputMergedSpecs writes the merge of the self-defined specs of merged into
+// the spec s.
+func outputMergedSpecs(w io.Writer, merged []*types.Named) {
+	for _, t := range merged {
+		fmt.Fprintf(w, "for k, v := range (&%s{}).HCL2Spec() {\n", t.String())
+		fmt.Fprintln(w, `s[k] = v`)
+		fmt.Fprintln(w, `}`)
+	}
+}
+
+func outputHCL2SpecField(w io.Writer, accessor string, fieldType types.Type, tag *structtag.Tags) {
+	outputHCL2Spec(w, accessor, fieldHCL2Spec(fieldType, tag))
+}
+
+// blockNesting is the kind of block of a fieldSpec.
+type blockNesting int
+
+const (
+	// noBlock is the nesting of an attribute.
+	noBlock blockNesting = iota
+	singleBlock
+	objectBlock
+	listBlock
+	attrsBlock
+)
+
+// fieldSpec is the hcldec spec of a field, as mapped from its Go type by
+// fieldHCL2Spec. outputHCL2Spec writes it and describeField describes it.
+type fieldSpec struct {
+	Nesting blockNesting
+	// Type is the cty type of an attribute or of the values of an attrs
+	// block.
+	Type cty.Type
+	// Struct is the Flat struct of a single, object or list block.
+	Struct types.Type
+	// SelfDefined is set for the single blocks whose struct has its own
+	// HCL2Spec method, see the self-defined tag option.
+	SelfDefined bool
+	// Values is the spec of the value held by each block of a list of
+	// blocks without a Struct.
+	Values *fieldSpec
+	// Items is the exact number of blocks of a list block of an array.
+	Items int64
+	// Unsupported is set for the fields whose type could not be found, that
+	// are set as a bool.
+	Unsupported bool
+}
+
+// fieldHCL2Spec maps the Go type of a field of a Flat struct to its spec.
+func fieldHCL2Spec(fieldType types.Type, tag *structtag.Tags) fieldSpec {
+	if m2h, err := tag.Get(generatorTag); err == nil && m2h.HasOption("self-defined") {
+		if p, isPointer := fieldType.(*types.Pointer); isPointer {
+			fieldType = p.Elem()
+		}
+		return fieldSpec{Nesting: singleBlock, Struct: fieldType, SelfDefined: true}
+	}
+	if override, err := tag.Get("hcl2type"); err == nil {
+		if _, t, err := parseTypeOverride(override.Value()); err == nil {
+			return fieldSpec{Type: t}
+		}
+	}
+	switch f := fieldType.(type) {
+	case *types.Pointer:
+		return fieldHCL2Spec(f.Elem(), tag)
+	case *types.Basic:
+		return fieldSpec{Type: basicKindToCtyType(f.Kind())}
+	case *types.Map:
+		// for now everything can be simplified to a map[string]string
+		return fieldSpec{Nesting: attrsBlock, Type: cty.String}
+	case *types.Slice:
+		if isByteSlice(f) {
+			// the `hcl2encoding:"base64"` tag tells the decode layer to
+			// decode this string.
+			return fieldSpec{Type: cty.String}
+		}
+		elem := f.Elem()
+		if ptr, isPtr := elem.(*types.Pointer); isPtr {
+			elem = ptr.Elem()
+		}
+		switch elem := elem.(type) {
+		case *types.Basic:
+			return fieldSpec{Type: cty.List(basicKindToCtyType(elem.Kind()))}
+		case *types.Named:
+			if m, isMap := elem.Underlying().(*types.Map); isMap {
+				// ex: `type Tags map[string]string`, like a map below.
+				return fieldSpec{Type: cty.List(cty.Map(mapElemCtyType(m)))}
+			}
+			if _, isStruct := elem.Underlying().(*types.Struct); isStruct {
+				// each block is decoded with the spec of the struct, so that
+				// the block labels of the struct are found.
+				return fieldSpec{Nesting: listBlock, Struct: elem}
+			}
+			values := fieldHCL2Spec(elem, tag)
+			return fieldSpec{Nesting: listBlock, Values: &values}
+		case *types.Slice:
+			values := fieldHCL2Spec(elem.Underlying(), tag)
+			return fieldSpec{Nesting: listBlock, Values: &values}
+		case *types.Map:
+			// ex: `tags = [{ a = "b" }, { c = "d" }]`.
+			return fieldSpec{Type: cty.List(cty.Map(mapElemCtyType(elem)))}
+		default:
+			return fieldHCL2Spec(elem.Underlying(), tag)
+		}
+	case *types.Array:
+		// a fixed length is set with exactly that many items.
+		switch elem := f.Elem().(type) {
+		case *types.Basic:
+			return fieldSpec{Type: cty.List(basicKindToCtyType(elem.Kind()))}
+		case *types.Named:
+			if _, isStruct := elem.Underlying().(*types.Struct); !isStruct {
+				return fieldHCL2Spec(types.NewArray(elem.Underlying(), f.Len()), tag)
+			}
+			return fieldSpec{Nesting: listBlock, Struct: elem, Items: f.Len()}
+		}
+	case *types.Named:
+		if f.String() == ctyValue.String() {
+			return fieldSpec{Type: cty.DynamicPseudoType}
+		}
+		if isBigNumber(f) {
+			return fieldSpec{Type: cty.Number}
+		}
+		if b, isNullable := nullableValue(f); isNullable {
+			return fieldSpec{Type: basicKindToCtyType(b.Kind())}
+		}
+		if _, isStruct := f.Underlying().(*types.Struct); isStruct {
+			return fieldSpec{Nesting: singleBlock, Struct: f}
+		}
+		// Underlying resolves chains of named types, ex: `type A B` and
+		// `type B string` both have a string underlying type.
+		return fieldHCL2Spec(f.Underlying(), tag)
+	case *types.Struct:
+		return fieldSpec{Nesting: objectBlock, Struct: f}
+	}
+	return fieldSpec{Type: cty.Bool, Unsupported: true}
+}
+
+// outputHCL2Spec writes spec as the hcldec spec of accessor.
+func outputHCL2Spec(w io.Writer, accessor string, spec fieldSpec) {
+	switch spec.Nesting {
+	case noBlock:
+		fmt.Fprintf(w, `%#v`, &hcldec.AttrSpec{
+			Name:     accessor,
+			Type:     spec.Type,
+			Required: false,
+		})
+		if spec.Unsupported {
+			fmt.Fprint(w, typeNotFoundMarker)
+		}
+	case attrsBlock:
+		fmt.Fprintf(w, `%#v`, &hcldec.BlockAttrsSpec{
+			TypeName:    accessor,
+			ElementType: spec.Type,
+			Required:    false,
+		})
+	case singleBlock:
+		if spec.SelfDefined {
+			fmt.Fprintf(w, `&hcldec.BlockSpec{TypeName: %q, Nested: hcldec.ObjectSpec((&%s{}).HCL2Spec())}`, accessor, spec.Struct.String())
+			return
+		}
+		fmt.Fprintf(w, `&hcldec.BlockSpec{TypeName: "%s",`+
+			` Nested: hcldec.ObjectSpec((*%s)(nil).HCL2Spec())}`, accessor, spec.Struct.String())
+	case objectBlock:
+		fmt.Fprintf(w, `&hcldec.BlockObjectSpec{TypeName: "%s",`+
+			` Nested: hcldec.ObjectSpec((*%s)(nil).HCL2Spec())}`, accessor, spec.Struct.String())
+	case listBlock:
+		switch {
+		case spec.Values != nil:
+			b := bytes.NewBuffer(nil)
+			outputHCL2Spec(b, accessor, *spec.Values)
+			fmt.Fprintf(w, `&hcldec.BlockListSpec{TypeName: "%s", Nested: %s}`, accessor, b.String())
+		case spec.Items > 0:
+			fmt.Fprintf(w, `&hcldec.BlockListSpec{TypeName: "%s",`+
+				` Nested: hcldec.ObjectSpec((*%s)(nil).HCL2Spec()), MinItems: %d, MaxItems: %d}`,
+				accessor, spec.Struct.String(), spec.Items, spec.Items)
+		default:
+			fmt.Fprintf(w, `&hcldec.BlockListSpec{TypeName: "%s",`+
+				` Nested: hcldec.ObjectSpec((*%s)(nil).HCL2Spec())}`, accessor, spec.Struct.String())
+		}
+	}
+}
+
+// typeNotFoundMarker is appended to the bool spec of fields of an
+// unsupported type.
+const typeNotFoundMarker = `/* TODO(azr): could not find type */`
+
+// mapElemCtyType returns the cty type of the values of m, maps that don't
+// hold basic values are simplified to map[string]string.
+func mapElemCtyType(m *types.Map) cty.Type {
+	if b, isBasic := m.Elem().Underlying().(*types.Basic); isBasic {
+		return basicKindToCtyType(b.Kind())
+	}
+	return cty.String
+}
+
+func basicKindToCtyType(kind types.BasicKind) cty.Type {
+	switch kind {
+	case types.Bool:
+		return cty.Bool
+	case types.String:
+		return cty.String
+	case types.Int, types.Int8, types.Int16, types.Int32, types.Int64,
+		types.Uint, types.Uint8, types.Uint16, types.Uint32, types.Uint64,
+		types.Float32, types.Float64:
+		return cty.Number
+	case types.Complex64, types.Complex128:
+		// a complex is set as a string, see getMapstructureSquashedStruct.
+		return cty.String
+	case types.Invalid:
+		return cty.String // TODO(azr): fix that beforehand ?
+	default:
+		log.Printf("Un handled basic kind: %d", kind)
+		return cty.String
+	}
+}
+
+func outputStructFields(w io.Writer, s *types.Struct) {
+	for i := 0; i < s.NumFields(); i++ {
+		field, tag := s.Field(i), s.Tag(i)
+		fmt.Fprintf(w, "	%s `%s`\n", strings.Replace(field.String(), "field ", "", 1), tag)
+	}
+}
+
+type NamePath struct {
+	Name, Path string
+}
+
+var (
+	hcldecImport = NamePath{"hcldec", "github.com/hashicorp/hcl/v2/hcldec"}
+	ctyImport    = NamePath{"cty", "github.com/zclconf/go-cty/cty"}
+	hclImport    = NamePath{"hcl", "github.com/hashicorp/hcl/v2"}
+	goctyImport  = NamePath{"gocty", "github.com/zclconf/go-cty/cty/gocty"}
+	// used by the String methods.
+	fmtImport     = NamePath{"fmt", "fmt"}
+	stringsImport = NamePath{"strings", "strings"}
+	// used by the DecodeCtyValue methods, by path as they share a name.
+	hclJSONImport = NamePath{"json", "github.com/hashicorp/hcl/v2/json"}
+	ctyJSONImport = NamePath{"json", "github.com/zclconf/go-cty/cty/json"}
+	// used by the ToCtyValue and DecodeCtyValue methods, by path as a
+	// package of the loaded package can be called config too.
+	configImport = NamePath{"config", "github.com/hashicorp/packer/helper/config"}
+)
+
+// importAliases returns the name under which each of imports is referenced
+// in the generated code. Packages sharing a name are given a numbered alias,
+// ex: config and config2.
+func importAliases(imports map[NamePath]*types.Package) map[NamePath]string {
+	pkgs := []NamePath{}
+	for k := range imports {
+		pkgs = append(pkgs, k)
+	}
+	// The packages that the generated code refers to by name and the ones
+	// without a slash, which are not replaced by their alias, get to keep
+	// their name.
+	priority := func(pkg NamePath) int {
+		switch {
+		case pkg == hcldecImport, pkg == ctyImport, pkg == hclImport, pkg == goctyImport,
+			pkg == fmtImport, pkg == stringsImport:
+			return 0
+		case !strings.ContainsAny(pkg.Path, "/"):
+			return 1
+		}
+		return 2
+	}
+	sort.Slice(pkgs, func(i int, j int) bool {
+		if pi, pj := priority(pkgs[i]), priority(pkgs[j]); pi != pj {
+			return pi < pj
+		}
+		return pkgs[i].Path < pkgs[j].Path
+	})
+
+	aliases := map[NamePath]string{}
+	taken := map[string]bool{}
+	for _, pkg := range pkgs {
+		alias := pkg.Name
+		for n := 2; taken[alias]; n++ {
+			alias = fmt.Sprintf("%s%d", pkg.Name, n)
+		}
+		taken[alias] = true
+		aliases[pkg] = alias
+	}
+	return aliases
+}
+
+func outputImports(w io.Writer, imports map[NamePath]string) {
+	if len(imports) == 0 {
+		return
+	}
+	// naive implementation
+	pkgs := []NamePath{}
+	for k := range imports {
+		pkgs = append(pkgs, k)
+	}
+	sort.Slice(pkgs, func(i int, j int) bool {
+		return pkgs[i].Path < pkgs[j].Path
+	})
+
+	fmt.Fprint(w, "import (\n")
+	for _, pkg := range pkgs {
+		alias := imports[pkg]
+		if alias == pkg.Path || strings.HasSuffix(pkg.Path, "/"+alias) {
+			fmt.Fprintf(w, "	\"%s\"\n", pkg.Path)
+		} else {
+			fmt.Fprintf(w, "	%s \"%s\"\n", alias, pkg.Path)
+		}
+	}
+	fmt.Fprint(w, ")\n")
+}
+
+func getUsedImports(s *types.Struct) map[NamePath]*types.Package {
+	res := map[NamePath]*types.Package{}
+	for i := 0; i < s.NumFields(); i++ {
+		addUsedImports(res, s.Field(i).Type())
+	}
+	return res
+}
+
+// addUsedImports adds the packages of the named types referenced by t to
+// imports, ex: both packages of a map[a.Key]*b.Value.
+func addUsedImports(imports map[NamePath]*types.Package, t types.Type) {
+	switch t := t.(type) {
+	case *types.Pointer:
+		addUsedImports(imports, t.Elem())
+	case *types.Slice:
+		addUsedImports(imports, t.Elem())
+	case *types.Array:
+		addUsedImports(imports, t.Elem())
+	case *types.Map:
+		addUsedImports(imports, t.Key())
+		addUsedImports(imports, t.Elem())
+	case *types.Named:
+		if pkg := t.Obj().Pkg(); pkg != nil {
+			imports[NamePath{pkg.Name(), pkg.Path()}] = pkg
+		}
+	}
+}
+
+// ctyAccessor returns the cty name of a field: its mapstructure name or its
+// snake cased name.
+func ctyAccessor(field *types.Var, tag string) string {
+	st, err := parseTag(tag)
+	if err == nil {
+		if ms, err := st.Get("mapstructure"); err == nil && ms.Name != "" {
+			return ms.Name
+		}
+	}
+	return ToSnakeCase(field.Name())
+}
+
+// renamedAccessor returns the cty name of field, the one set in renames for
+// the struct it comes from if any, see Options.FieldRenames.
+func renamedAccessor(field *types.Var, tag string, origins map[token.Pos]string, renames map[string]string) string {
+	if origin, found := origins[field.Pos()]; found {
+		if name, found := renames[origin+"."+field.Name()]; found {
+			return name
+		}
+	}
+	return ctyAccessor(field, tag)
+}
+
+// duplicateAccessors describes the fields of s that have the cty name of a
+// previous field, naming the struct each field comes from with origins.
+// Conflicts are the fields of a different type than the previous field.
+func duplicateAccessors(s *types.Struct, origins map[token.Pos]string, renames map[string]string) (conflicts, dups []string) {
+	seen := map[string]*types.Var{}
+	qualified := func(field *types.Var) string {
+		if origin, found := origins[field.Pos()]; found {
+			return origin + "." + field.Name()
+		}
+		return field.Name()
+	}
+	for i := 0; i < s.NumFields(); i++ {
+		field := s.Field(i)
+		accessor := renamedAccessor(field, s.Tag(i), origins, renames)
+		if prev, found := seen[accessor]; found {
+			desc := fmt.Sprintf("%q is the cty name of both %s (%s) and %s (%s)",
+				accessor, qualified(prev), prev.Type(), qualified(field), field.Type())
+			if types.Identical(prev.Type(), field.Type()) {
+				dups = append(dups, desc)
+			} else {
+				conflicts = append(conflicts, desc)
+			}
+			continue
+		}
+		seen[accessor] = field
+	}
+	return conflicts, dups
+}
+
+// fieldOrigins records the name of the struct declaring each field of s,
+// and of the structs it squashes, by field position.
+func fieldOrigins(structName string, s *types.Struct, origins map[token.Pos]string) map[token.Pos]string {
+	if origins == nil {
+		origins = map[token.Pos]string{}
+	}
+	for i := 0; i < s.NumFields(); i++ {
+		field := s.Field(i)
+		origins[field.Pos()] = structName
+		st, err := parseTag(s.Tag(i))
+		if err != nil {
+			continue
+		}
+		if ms, err := st.Get("mapstructure"); err != nil || !ms.HasOption("squash") {
+			continue
+		}
+		ft := field.Type()
+		if p, isPointer := ft.(*types.Pointer); isPointer {
+			ft = p.Elem()
+		}
+		if named, isNamed := ft.(*types.Named); isNamed {
+			if str, isStruct := named.Underlying().(*types.Struct); isStruct {
+				fieldOrigins(named.Obj().Name(), str, origins)
+			}
+		}
+	}
+	return origins
+}
+
+// parseTag parses tag like reflect does, ignoring its surrounding spaces for
+// which structtag.Parse returns no tags.
+func parseTag(tag string) (*structtag.Tags, error) {
+	return structtag.Parse(strings.TrimSpace(tag))
+}
+
+// addCtyTagToStruct sets the cty tag of the fields of s, path is the name of
+// s in the logs. The fields are renamed with renames, see
+// Options.FieldRenames, origins being where each field comes from.
+func addCtyTagToStruct(s *types.Struct, path string, origins map[token.Pos]string, opts Options) *types.Struct {
+	vars, tags := structFields(s)
+	for i := range tags {
+		field, tag := vars[i], tags[i]
+		ctyAccessor := renamedAccessor(field, tag, origins, opts.FieldRenames)
+		st, err := parseTag(tag)
+		if err != nil {
+			// ex: set by a FieldTransformer.
+			logf(opts.log, field.Pos(), "field %s.%s: ignoring its malformed tag `%s`: %v", path, field.Name(), tag, err)
+			st, _ = parseTag("")
+		}
+		// the complex, rune and time fields are tagged with their encoding
+		// and the Nullable ones with their bounds when their type is
+		// replaced, those tags are set again after the cty one so that the
+		// generator tags of every field come in the same order.
+		bounds, boundsErr := st.Get("hcl2bounds")
+		encoding, encodingErr := st.Get("hcl2encoding")
+		st.Delete("hcl2bounds", "hcl2encoding")
+		st.Set(&structtag.Tag{Key: "cty", Name: ctyAccessor})
+		if b, found := unsignedBounds(field.Type()); found {
+			st.Set(&structtag.Tag{Key: "hcl2bounds", Name: b})
+		} else if boundsErr == nil {
+			st.Set(bounds)
+		}
+		if isByteSlice(field.Type()) {
+			st.Set(&structtag.Tag{Key: "hcl2encoding", Name: "base64"})
+		} else if encodingErr == nil {
+			st.Set(encoding)
+		}
+		tags[i] = st.String()
+	}
+	return types.NewStruct(uniqueTags("cty", vars, tags, path, opts.log))
+}
+
+// isByteSlice tells whether t is a []byte, binary data is set as a base64
+// string in HCL2 rather than as a list of numbers.
+func isByteSlice(t types.Type) bool {
+	slice, isSlice := t.Underlying().(*types.Slice)
+	if !isSlice {
+		return false
+	}
+	b, isBasic := slice.Elem().Underlying().(*types.Basic)
+	return isBasic && b.Kind() == types.Uint8
+}
+
+// addHCLTagToStruct adds a `hcl:"name,optional"` tag to the attributes of s
+// and a `hcl:"name,block"` tag to its blocks, named after their cty tag.
+func addHCLTagToStruct(s *types.Struct) *types.Struct {
+	vars, tags := structFields(s)
+	for i := range tags {
+		st, err := parseTag(tags[i])
+		if err != nil {
+			continue
+		}
+		ctyTag, err := st.Get("cty")
+		if err != nil {
+			continue
+		}
+		kind := "optional"
+		if isBlock(vars[i].Type()) {
+			kind = "block"
+		}
+		st.Set(&structtag.Tag{Key: "hcl", Name: ctyTag.Name, Options: []string{kind}})
+		tags[i] = st.String()
+	}
+	return types.NewStruct(vars, tags)
+}
+
+// isBlock tells whether a field of type t is a block, or a list of blocks,
+// in HCL2.
+func isBlock(t types.Type) bool {
+	if p, isPointer := t.(*types.Pointer); isPointer {
+		t = p.Elem()
+	}
+	if s, isSlice := t.(*types.Slice); isSlice {
+		t = s.Elem()
+	}
+	if p, isPointer := t.(*types.Pointer); isPointer {
+		t = p.Elem()
+	}
+	if n, isNamed := t.(*types.Named); isNamed && n.String() == ctyValue.String() {
+		return false
+	}
+	if _, isNullable := nullableValue(t); isNullable {
+		return false
+	}
+	_, isStruct := t.Underlying().(*types.Struct)
+	return isStruct
+}
+
+// unsignedBounds returns the "min,max" bounds of an unsigned number type.
+// HCL2 numbers can be negative or bigger than the Go type allows, the decode
+// layer uses the `hcl2bounds` tag to reject those with a clear diagnostic.
+// The upper bound of a uint is left empty since it depends on the platform.
+func unsignedBounds(t types.Type) (string, bool) {
+	if p, isPointer := t.(*types.Pointer); isPointer {
+		t = p.Elem()
+	}
+	b, isBasic := t.Underlying().(*types.Basic)
+	if !isBasic {
+		return "", false
+	}
+	switch b.Kind() {
+	case types.Uint8, types.Uint16, types.Uint32, types.Uint64:
+		_, max := integerRange(b.Kind())
+		return fmt.Sprintf("0,%d", max), true
+	case types.Uint, types.Uintptr:
+		return "0,", true
+	}
+	return "", false
+}
+
+// integerRange returns the range of the values of the integer kind, int and
+// uint being 64 bits wide.
+func integerRange(kind types.BasicKind) (int64, uint64) {
+	switch kind {
+	case types.Int8:
+		return math.MinInt8, math.MaxInt8
+	case types.Int16:
+		return math.MinInt16, math.MaxInt16
+	case types.Int32:
+		return math.MinInt32, math.MaxInt32
+	case types.Uint8:
+		return 0, math.MaxUint8
+	case types.Uint16:
+		return 0, math.MaxUint16
+	case types.Uint32:
+		return 0, math.MaxUint32
+	case types.Uint, types.Uint64, types.Uintptr:
+		return 0, math.MaxUint64
+	}
+	return math.MinInt64, math.MaxInt64
+}
+
+func uniqueTags(tagName string, fields []*types.Var, tags []string, path string, l *logger) ([]*types.Var, []string) {
+	outVars := []*types.Var{}
+	outTags := []string{}
+	uniqueTags := map[string]bool{}
+	for i := range fields {
+		field, tag := fields[i], tags[i]
+		structtag, _ := parseTag(tag)
+		h, err := structtag.Get(tagName)
+		if err == nil {
+			if uniqueTags[h.Name] {
+				logf(l, field.Pos(), "skipping field %s.%s ( duplicate `%s` %s tag  )", path, field.Name(), h.Name, tagName)
+				continue
+			}
+			uniqueTags[h.Name] = true
+		}
+		outVars = append(outVars, field)
+		outTags = append(outTags, tag)
+	}
+	return outVars, outTags
+}
+
+// getMapstructureSquashedStruct will return the same struct but embedded
+// fields with a `mapstructure:",squash"` tag will be un-nested. The fields of
+// the struct referenced by a `mapstructure:",include=pkg.Other"` tag are
+// un-nested in place of the tagged field. A field with a
+// `mapstructure:"x,impl=path/to/pkg.Type"` tag is set as that type, or as a
+// slice of that type for a slice of interfaces. path is
+// where utStruct is in the logs, ex: Config.CommonConfig. The squashed types
+// that have a self-defined HCL2Spec are returned too, their fields are still
+// flattened to decode into.
+func getMapstructureSquashedStruct(topPkg *types.Package, utStruct *types.Struct, opts Options, path string, depth int) (*types.Struct, []*types.Named, error) {
+	res := &types.Struct{}
+	var merged []*types.Named
+	for i := 0; i < utStruct.NumFields(); i++ {
+		field, tag := utStruct.Field(i), utStruct.Tag(i)
+		keep := true
+		for _, transform := range opts.FieldTransformers {
+			if field, tag, keep = transform(field, tag); !keep {
+				break
+			}
+		}
+		if !keep {
+			continue
+		}
+		if t := resolveAliases(field.Type()); t != field.Type() {
+			// aliases are handled like their type, ex: a
+			// `type MyDur = time.Duration` is set as a string.
+			field = types.NewField(field.Pos(), field.Pkg(), field.Name(), t, field.Embedded())
+		}
+		fieldPath := path + "." + field.Name()
+		tag = strings.TrimSpace(tag)
+		if _, err := parseTag(tag); err != nil {
+			// reflect, and so mapstructure, ignore all of a malformed tag.
+			logf(opts.log, field.Pos(), "field %s: ignoring its malformed tag `%s`: %v", fieldPath, tag, err)
+			tag = ""
+		}
+		if ref := includeRef(tag); ref != "" {
+			// the tagged field is only a marker, ex: `_ struct{}`.
+			included, err := lookupStruct(topPkg, ref)
+			if err != nil {
+				logf(opts.log, field.Pos(), "not including %s in %s: %v", ref, path, err)
+				continue
+			}
+			squashed, nestedMerged, err := getMapstructureSquashedStruct(topPkg, included, opts, path+"."+ref, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			res = squashStructs(res, squashed, path, opts.log)
+			merged = append(merged, nestedMerged...)
+			continue
+		}
+		if !field.Exported() || isIgnored(field.Name(), opts) {
+			continue
+		}
+		if _, ok := field.Type().Underlying().(*types.Signature); ok {
+			continue // ignore funcs, and named ones like iter.Seq[T]
+		}
+		structtag, _ := parseTag(tag)
+		ms, err := structtag.Get("mapstructure")
+		squash := err == nil && ms.HasOption("squash")
+		if opts.SquashEmbedded && field.Embedded() && (err != nil || ms.Name == "") {
+			squash = true
+		}
+		ot := field.Type()
+		if p, isPointer := ot.(*types.Pointer); isPointer && squash {
+			// mapstructure squashes the struct a pointer points to, and Go
+			// promotes the fields of an embedded pointer too.
+			ot = p.Elem()
+		}
+		if _, isNamed := ot.(*types.Named); squash && isNamed && opts.MaxDepth > 0 && depth >= opts.MaxDepth {
+			// too deep, this becomes a block.
+			squash = false
+		}
+		if squash {
+			utStruct, utOk := ot.Underlying().(*types.Struct)
+			if !utOk {
+				// its fields would be lost without a trace otherwise.
+				logf(opts.log, field.Pos(), "skipping field %s: squash is only supported on structs, %s is not one", fieldPath, field.Type())
+				continue
+			}
+
+			squashed, nestedMerged, err := getMapstructureSquashedStruct(topPkg, utStruct, opts, fieldPath, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			res = squashStructs(res, squashed, path, opts.log)
+			merged = append(merged, nestedMerged...)
+			if named, isNamed := ot.(*types.Named); isNamed && hasSelfDefinedSpec(named) {
+				merged = append(merged, named)
+			}
+			continue
+		} else if err == nil && ms.HasOption("unwrap") {
+			unwrapped, err := unwrapField(field)
+			if err != nil {
+				logf(opts.log, field.Pos(), "not unwrapping field %s: %v", fieldPath, err)
+			} else {
+				field = unwrapped
+			}
+		} else if opts.CollapseWrappers && isWrapperStruct(field.Type()) {
+			// the generator options or the impl of a field tell how to
+			// handle it instead.
+			if _, m2hErr := structtag.Get(generatorTag); m2hErr != nil && (err != nil || tagOptionValue(ms, "impl") == "") {
+				field, _ = unwrapField(field)
+			}
+		}
+		if err == nil {
+			if ref := tagOptionValue(ms, "impl"); ref != "" {
+				impl, err := lookupImpl(topPkg, ref)
+				if err != nil {
+					return nil, nil, fmt.Errorf("field %s: %v", field.Name(), err)
+				}
+				iface := field.Type()
+				slice, isSlice := iface.(*types.Slice)
+				if isSlice {
+					// ex: a list of provisioner blocks, each one decoded
+					// with the HCL2Spec of impl.
+					iface = slice.Elem()
+				}
+				if err := checkImplements(impl, iface, ref); err != nil {
+					return nil, nil, fmt.Errorf("field %s: %v", field.Name(), err)
+				}
+				if isSlice {
+					impl = types.NewSlice(impl)
+				}
+				field = types.NewField(field.Pos(), field.Pkg(), field.Name(), impl, field.Embedded())
+			}
+		}
+		if err == nil && !ms.HasOption("unique") {
+			if err := checkIntegerBounds(field, ms); err != nil {
+				return nil, nil, fmt.Errorf("field %s: %v", field.Name(), err)
+			}
+		}
+		if def := defaultTagValue(structtag); def != "" {
+			// the `hcl2default:"value"` tag holds the resolved value for the
+			// Defaults and ApplyDefaults methods.
+			value, err := resolveDefault(field, def)
+			if err != nil {
+				return nil, nil, fmt.Errorf("field %s: %v", field.Name(), err)
+			}
+			tag = strings.TrimSpace(tag + " hcl2default:" + strconv.Quote(value))
+		}
+		if field.Pkg() != topPkg {
+			field = types.NewField(field.Pos(), topPkg, field.Name(), field.Type(), field.Embedded())
+		}
+		p, isPointer := field.Type().(*types.Pointer)
+		if isPointer {
+			// in order to make the following switch simpler we 'unwrap' this
+			// pointer all structs are going to be made pointers anyways.
+			field = types.NewField(field.Pos(), field.Pkg(), field.Name(), p.Elem(), field.Embedded())
+		}
+		optional := (isPointer || !opts.RequiredFromNonPointer) && !opts.NoPointerBasics && !isRequired(ctyAccessor(field, tag), opts)
+		if override, err := structtag.Get("hcl2type"); err == nil {
+			// ex: `hcl2type:"string"` on a wrapper type the generator gets
+			// wrong, the field is set as the Go type of the override.
+			t, _, err := parseTypeOverride(override.Value())
+			if err != nil {
+				return nil, nil, fmt.Errorf("field %s: %v", field.Name(), err)
+			}
+			field = types.NewField(field.Pos(), field.Pkg(), field.Name(), t, field.Embedded())
+			res = addFieldToStruct(res, field, tag, path, opts.log)
+			continue
+		}
+		if isComplex(field.Type()) {
+			// cty has no complex type and a cty.Number would drop the
+			// imaginary part, so complex numbers are set as strings in
+			// their canonical form, ex: "(1+2i)". The `hcl2encoding:"complex"`
+			// tag tells the decode layer to check that the string can be
+			// scanned back into a complex with fmt.Sscan.
+			field = types.NewField(field.Pos(), field.Pkg(), field.Name(), types.NewPointer(types.Typ[types.String]), field.Embedded())
+			tag = strings.TrimSpace(tag + ` hcl2encoding:"complex"`)
+			res = addFieldToStruct(res, field, tag, path, opts.log)
+			continue
+		}
+		if isRune(field.Type()) {
+			// a rune is a character rather than a number, so it is set as a
+			// one character string, ex: "a". The `hcl2encoding:"rune"` tag
+			// tells the decode layer to check that the string is a single
+			// character. A plain int32 stays a number.
+			field = types.NewField(field.Pos(), field.Pkg(), field.Name(), types.NewPointer(types.Typ[types.String]), field.Embedded())
+			tag = strings.TrimSpace(tag + ` hcl2encoding:"rune"`)
+			res = addFieldToStruct(res, field, tag, path, opts.log)
+			continue
+		}
+		if m2h, err := structtag.Get(generatorTag); isEmptyInterface(field.Type()) || err == nil && m2h.HasOption("dynamic") {
+			// interface{} and any fields can be set to anything, so can the
+			// fields with a `mapstructure-to-hcl2:",dynamic"` tag, ex: a
+			// free-form metadata document.
+			field = types.NewField(field.Pos(), field.Pkg(), field.Name(), ctyValue, field.Embedded())
+			res = addFieldToStruct(res, field, tag, path, opts.log)
+			continue
+		}
+		if iface, isInterface := field.Type().Underlying().(*types.Interface); isInterface && !hasHCL2Spec(iface) {
+			// ex: an io.Reader, set from code rather than from a config.
+			logf(opts.log, field.Pos(), "skipping field %s: %s is an interface", fieldPath, field.Type())
+			continue
+		}
+		switch f := field.Type().(type) {
+		case *types.Named:
+			switch f.String() {
+			case "time.Duration", "time.Time":
+				// set as a string, ex: "1m30s" or "2006-01-02T15:04:05Z". The
+				// pointer of a *time.Duration was unwrapped above. This
+				// continues right away so that the struct underlying a
+				// time.Time is not flattened.
+				field = types.NewField(field.Pos(), field.Pkg(), field.Name(), types.NewPointer(types.Typ[types.String]), field.Embedded())
+				if f.String() == "time.Time" {
+					// the `hcl2encoding:"rfc3339"` tag tells the decode
+					// layer to check that the string parses as a time.
+					tag = strings.TrimSpace(tag + ` hcl2encoding:"rfc3339"`)
+				}
+				res = addFieldToStruct(res, field, tag, path, opts.log)
+				continue
+			}
+			if isBigNumber(f) {
+				// set as a number, gocty decodes it exactly. The pointer of
+				// a *big.Int was unwrapped above.
+				field = makePointer(field)
+				res = addFieldToStruct(res, field, tag, path, opts.log)
+				continue
+			}
+			if isExecutionPolicy(f) {
+				// set as its enumer string, ex: "bypass".
+				field = types.NewField(field.Pos(), field.Pkg(), field.Name(), types.NewPointer(types.Typ[types.String]), field.Embedded())
+			}
+			if isTrilean(f) {
+				field = types.NewField(field.Pos(), field.Pkg(), field.Name(), types.NewPointer(types.Typ[types.Bool]), field.Embedded())
+			}
+			if _, isBasic := f.Underlying().(*types.Basic); isBasic && field.Type() == f && optional {
+				// ex: `type Flag bool`, optional like the basic types.
+				if opts.KeepZeroValueDistinction {
+					field, tag = makeNullable(field, tag)
+				} else {
+					field = makePointer(field)
+				}
+			}
+			if str, isStruct := f.Underlying().(*types.Struct); isStruct {
+				if m2h, err := structtag.Get(generatorTag); err == nil && m2h.HasOption("self-defined") {
+					// decoded with the HCL2Spec of the type itself.
+					field = makePointer(field)
+					res = addFieldToStruct(res, field, tag, path, opts.log)
+					continue
+				}
+				if opts.LintSelfDefined && hasSelfDefinedSpec(f) {
+					logf(opts.log, field.Pos(), "field %s: %s has a HCL2Spec method but is flattened, tag it with `%s:\",self-defined\"` to use it", fieldPath, f, generatorTag)
+				}
+				obj := flattenNamed(f, str, topPkg, opts)
+				field = types.NewField(field.Pos(), field.Pkg(), field.Name(), obj, field.Embedded())
+				field = makePointer(field)
+			}
+			if slice, isSlice := f.Underlying().(*types.Slice); isSlice {
+				if f, fNamed := slice.Elem().(*types.Named); fNamed {
+					if str, isStruct := f.Underlying().(*types.Struct); isStruct {
+						// this is a slice of named structs; we want to change
+						// the struct ref to a 'FlatStruct'.
+						obj := flattenNamed(f, str, topPkg, opts)
+						slice := types.NewSlice(obj)
+						field = types.NewField(field.Pos(), field.Pkg(), field.Name(), slice, field.Embedded())
+					}
+				}
+			}
+		case *types.Slice:
+			if elem, isNamed := f.Elem().(*types.Named); isNamed && elem.String() == "time.Time" {
+				// like a time.Time, a list of RFC 3339 strings.
+				field = types.NewField(field.Pos(), field.Pkg(), field.Name(), types.NewSlice(types.Typ[types.String]), field.Embedded())
+				tag = strings.TrimSpace(tag + ` hcl2encoding:"rfc3339"`)
+				res = addFieldToStruct(res, field, tag, path, opts.log)
+				continue
+			}
+			if f, fNamed := f.Elem().(*types.Named); fNamed {
+				if str, isStruct := f.Underlying().(*types.Struct); isStruct {
+					obj := flattenNamed(f, str, topPkg, opts)
+					field = types.NewField(field.Pos(), field.Pkg(), field.Name(), types.NewSlice(obj), field.Embedded())
+				}
+			}
+		case *types.Array:
+			if elem, fNamed := f.Elem().(*types.Named); fNamed {
+				if str, isStruct := elem.Underlying().(*types.Struct); isStruct {
+					obj := flattenNamed(elem, str, topPkg, opts)
+					field = types.NewField(field.Pos(), field.Pkg(), field.Name(), types.NewArray(obj, f.Len()), field.Embedded())
+				}
+			}
+		case *types.Basic:
+			// since everything is optional, everything must be a pointer
+			// non optional fields should be non pointers.
+			if optional && opts.KeepZeroValueDistinction {
+				field, tag = makeNullable(field, tag)
+			} else if optional {
+				field = makePointer(field)
+			}
+		}
+		res = addFieldToStruct(res, field, tag, path, opts.log)
+	}
+	return res, merged, nil
+}
+
+// hoistAnonymousStructs replaces the anonymous struct fields of s with
+// generated Flat structs named after structName and the field, ex: the Opts
+// field of FlatConfig becomes a *FlatConfigOpts. An anonymous struct can't be
+// referenced from the HCL2Spec of its parent otherwise.
+func hoistAnonymousStructs(pkg *types.Package, structName string, s *types.Struct, opts Options) (*types.Struct, []StructDef, error) {
+	var hoisted []StructDef
+	fields, tags := structFields(s)
+	for i, field := range fields {
+		ft := field.Type()
+		slice, isSlice := ft.(*types.Slice)
+		if isSlice {
+			ft = slice.Elem()
+		}
+		str, isStruct := ft.(*types.Struct)
+		if !isStruct {
+			continue
+		}
+		name := structName + field.Name()
+		flat, merged, err := getMapstructureSquashedStruct(pkg, str, opts, name, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		flat = addCtyTagToStruct(flat, name, fieldOrigins(name, str, nil), opts)
+		if opts.EmitHCLTags {
+			flat = addHCLTagToStruct(flat)
+		}
+		flat, nested, err := hoistAnonymousStructs(pkg, name, flat, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		hoisted = append(hoisted, StructDef{StructName: name, Struct: flat, MergedSpecs: merged})
+		hoisted = append(hoisted, nested...)
+
+		var t types.Type = types.NewNamed(types.NewTypeName(field.Pos(), pkg, name, nil), flat, nil)
+		if isSlice {
+			t = types.NewSlice(t)
+		} else {
+			t = types.NewPointer(t)
+		}
+		fields[i] = types.NewField(field.Pos(), field.Pkg(), field.Name(), t, field.Embedded())
+	}
+	return types.NewStruct(fields, tags), hoisted, nil
+}
+
+func isIgnored(fieldName string, opts Options) bool {
+	for _, ignored := range opts.IgnoreFields {
+		if fieldName == ignored {
+			return true
+		}
+	}
+	return false
+}
+
+// isRequired tells whether the field named accessor is one of the
+// Options.RequiredFields.
+func isRequired(accessor string, opts Options) bool {
+	for _, required := range opts.RequiredFields {
+		if accessor == required {
+			return true
+		}
+	}
+	return false
+}
+
+// includeRef returns the value of the include option of the mapstructure
+// tag.
+func includeRef(tag string) string {
+	st, err := parseTag(tag)
+	if err != nil {
+		return ""
+	}
+	ms, err := st.Get("mapstructure")
+	if err != nil {
+		return ""
+	}
+	return tagOptionValue(ms, "include")
+}
+
+// lookupStruct returns the struct referenced by ref from topPkg, ex: Other
+// or pkg.Other where pkg is imported by topPkg. path is where ref is included
+// in the logs.
+func lookupStruct(topPkg *types.Package, ref string) (*types.Struct, error) {
+	pkg, name := topPkg, ref
+	if i := strings.LastIndex(ref, "."); i >= 0 {
+		pkg = nil
+		for _, imp := range topPkg.Imports() {
+			if imp.Name() == ref[:i] || imp.Path() == ref[:i] {
+				pkg = imp
+				break
+			}
+		}
+		name = ref[i+1:]
+	}
+	if pkg == nil {
+		return nil, fmt.Errorf("package is not imported by %s", topPkg.Path())
+	}
+	obj := pkg.Scope().Lookup(name)
+	if obj == nil {
+		return nil, fmt.Errorf("type not found")
+	}
+	str, isStruct := obj.Type().Underlying().(*types.Struct)
+	if !isStruct {
+		return nil, fmt.Errorf("%s is not a struct", obj.Type())
+	}
+	return str, nil
+}
+
+// lookupImpl returns the type referenced by the fully qualified ref of an
+// impl option, ex: github.com/foo/bar.Baz. The package of ref must be
+// topPkg or one of its direct or indirect imports.
+func lookupImpl(topPkg *types.Package, ref string) (types.Type, error) {
+	i := strings.LastIndex(ref, ".")
+	if i < 0 {
+		return nil, fmt.Errorf("impl %q is not of the form path/to/pkg.Type", ref)
+	}
+	path, name := ref[:i], ref[i+1:]
+	pkg := findImport(topPkg, path, map[*types.Package]bool{})
+	if pkg == nil {
+		return nil, fmt.Errorf("impl %s: package %s is not imported by %s", ref, path, topPkg.Path())
+	}
+	obj, isTypeName := pkg.Scope().Lookup(name).(*types.TypeName)
+	if !isTypeName {
+		return nil, fmt.Errorf("impl %s: type %s not found in %s", ref, name, path)
+	}
+	return obj.Type(), nil
+}
+
+// checkImplements errors when neither impl nor a pointer to it implements
+// iface, the interface type of a field with an impl=ref option. Fields that
+// are not interfaces are not checked.
+func checkImplements(impl, iface types.Type, ref string) error {
+	i, isInterface := iface.Underlying().(*types.Interface)
+	if !isInterface || types.Implements(impl, i) || types.Implements(types.NewPointer(impl), i) {
+		return nil
+	}
+	return fmt.Errorf("impl %s does not implement %s", ref, iface)
+}
+
+// findImport returns the package of path among pkg and its imports,
+// recursively.
+func findImport(pkg *types.Package, path string, seen map[*types.Package]bool) *types.Package {
+	if pkg.Path() == path {
+		return pkg
+	}
+	seen[pkg] = true
+	for _, imp := range pkg.Imports() {
+		if seen[imp] {
+			continue
+		}
+		if found := findImport(imp, path, seen); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// resolveDefault returns the value of the default option of field. The
+// option is either a literal, ex: default=22, or the name of a constant of
+// the package of field or of one of its imports, ex: default=DefaultPort or
+// default=pkg.DefaultPort.
+func resolveDefault(field *types.Var, def string) (string, error) {
+	ft := field.Type()
+	if p, isPointer := ft.(*types.Pointer); isPointer {
+		ft = p.Elem()
+	}
+	b, isBasic := ft.Underlying().(*types.Basic)
+	if !isBasic {
+		return "", fmt.Errorf("default %s: %s is not a basic type", def, ft)
+	}
+	if c := lookupConst(field.Pkg(), def); c != nil {
+		def = constantString(c.Val())
+	}
+	switch {
+	case b.Info()&types.IsBoolean != 0:
+		parsed, err := strconv.ParseBool(def)
+		if err != nil {
+			return "", fmt.Errorf("default %s is not a bool", def)
+		}
+		// ParseBool accepts 1 or T, which are not Go bools.
+		def = strconv.FormatBool(parsed)
+	case b.Info()&types.IsNumeric != 0:
+		if _, err := cty.ParseNumberVal(def); err != nil {
+			return "", fmt.Errorf("default %s is not a number", def)
+		}
+		if b.Info()&types.IsInteger != 0 {
+			_, errInt := strconv.ParseInt(def, 10, 64)
+			_, errUint := strconv.ParseUint(def, 10, 64)
+			if errInt != nil && errUint != nil {
+				return "", fmt.Errorf("default %s is not an integer", def)
+			}
+		}
+	}
+	return def, nil
+}
+
+// checkIntegerBounds returns an error when the min or max option of ms, the
+// mapstructure tag of field, is not an integer of the type of field while
+// field is an integer: Validate compares the field to them and would not
+// compile.
+func checkIntegerBounds(field *types.Var, ms *structtag.Tag) error {
+	ft := field.Type()
+	if p, isPointer := ft.(*types.Pointer); isPointer {
+		ft = p.Elem()
+	}
+	b, isBasic := ft.Underlying().(*types.Basic)
+	if !isBasic || b.Info()&types.IsInteger == 0 {
+		return nil
+	}
+	min, max := integerRange(b.Kind())
+	for _, key := range []string{"min", "max"} {
+		bound := tagOptionValue(ms, key)
+		if bound == "" {
+			continue
+		}
+		i, errInt := strconv.ParseInt(bound, 10, 64)
+		u, errUint := strconv.ParseUint(bound, 10, 64)
+		if errInt != nil && errUint != nil {
+			return fmt.Errorf("%s %s is not an integer", key, bound)
+		}
+		if errInt == nil && i < min || errUint == nil && u > max {
+			return fmt.Errorf("%s %s is out of the [%d,%d] range of %s", key, bound, min, max, b)
+		}
+	}
+	return nil
+}
+
+// lookupConst returns the constant referenced by ref from pkg, ex: Other or
+// other.Other where other is imported by pkg, or nil.
+func lookupConst(pkg *types.Package, ref string) *types.Const {
+	if pkg == nil {
+		return nil
+	}
+	scope, name := pkg.Scope(), ref
+	if i := strings.LastIndex(ref, "."); i >= 0 {
+		scope = nil
+		for _, imp := range pkg.Imports() {
+			if imp.Name() == ref[:i] {
+				scope = imp.Scope()
+				break
+			}
+		}
+		name = ref[i+1:]
+	}
+	if scope == nil {
+		return nil
+	}
+	c, _ := scope.Lookup(name).(*types.Const)
+	return c
+}
+
+// constantString returns v as it would be written in a default option.
+func constantString(v constant.Value) string {
+	switch v.Kind() {
+	case constant.String:
+		return constant.StringVal(v)
+	case constant.Float:
+		f, _ := constant.Float64Val(v)
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return v.ExactString()
+}
+
+// isWrapperStruct tells whether t, or the type it points to, is a named struct
+// that only wraps a value: its single field is exported, not embedded, and of
+// a basic type or a slice of those. Structs with methods are not wrappers,
+// their methods may depend on the struct, ex: a Validate method.
+func isWrapperStruct(t types.Type) bool {
+	if p, isPointer := t.(*types.Pointer); isPointer {
+		t = p.Elem()
+	}
+	named, isNamed := t.(*types.Named)
+	if !isNamed || types.NewMethodSet(types.NewPointer(named)).Len() > 0 {
+		return false
+	}
+	str, isStruct := named.Underlying().(*types.Struct)
+	if !isStruct || str.NumFields() != 1 || !str.Field(0).Exported() || str.Field(0).Embedded() {
+		return false
+	}
+	ft := str.Field(0).Type()
+	if slice, isSlice := ft.Underlying().(*types.Slice); isSlice {
+		ft = slice.Elem()
+	}
+	_, isBasic := ft.Underlying().(*types.Basic)
+	return isBasic
+}
+
+// unwrapField returns field typed as the only field of its wrapper struct,
+// this is set with a `mapstructure:"x,unwrap"` tag. ex: a field of type
+// `struct{ V string }` will be treated as a string.
+func unwrapField(field *types.Var) (*types.Var, error) {
+	ft := field.Type()
+	if p, isPointer := ft.(*types.Pointer); isPointer {
+		ft = p.Elem()
+	}
+	str, isStruct := ft.Underlying().(*types.Struct)
+	if !isStruct || str.NumFields() != 1 {
+		return nil, fmt.Errorf("%s is not a single field struct", ft)
+	}
+	return types.NewField(field.Pos(), field.Pkg(), field.Name(), str.Field(0).Type(), field.Embedded()), nil
+}
+
+// isBigNumber tells whether t is a math/big.Int or a math/big.Float, which
+// cty.Number values convert to exactly.
+func isBigNumber(t *types.Named) bool {
+	switch t.String() {
+	case "math/big.Int", "math/big.Float":
+		return true
+	}
+	return false
+}
+
+// isTrilean tells whether t is shaped like config.Trilean: an unset, true or
+// false integer. Matching the shape rather than the import path allows
+// Trileans to be detected in forks.
+func isTrilean(t *types.Named) bool {
+	if b, isBasic := t.Underlying().(*types.Basic); !isBasic || b.Info()&types.IsInteger == 0 {
+		return false
+	}
+	mset := types.NewMethodSet(t)
+	for name, result := range map[string]string{
+		"True":          "bool",
+		"False":         "bool",
+		"ToBoolPointer": "*bool",
+	} {
+		sel := mset.Lookup(nil, name)
+		if sel == nil {
+			return false
+		}
+		sig := sel.Type().(*types.Signature)
+		if sig.Params().Len() != 0 || sig.Results().Len() != 1 || sig.Results().At(0).Type().String() != result {
+			return false
+		}
+	}
+	return true
+}
+
+// isExecutionPolicy tells whether t is powershell.ExecutionPolicy. The path
+// is matched relatively to the module, so that it is detected in forks.
+func isExecutionPolicy(t *types.Named) bool {
+	obj := t.Obj()
+	if obj.Name() != "ExecutionPolicy" || obj.Pkg() == nil {
+		return false
+	}
+	return strings.HasSuffix("/"+obj.Pkg().Path(), "/provisioner/powershell")
+}
+
+// hasSelfDefinedSpec tells whether t, or a pointer to t, has an
+// `HCL2Spec() map[string]hcldec.Spec` method.
+func hasSelfDefinedSpec(t *types.Named) bool {
+	sel := types.NewMethodSet(types.NewPointer(t)).Lookup(t.Obj().Pkg(), "HCL2Spec")
+	if sel == nil {
+		return false
+	}
+	sig := sel.Type().(*types.Signature)
+	return sig.Params().Len() == 0 && sig.Results().Len() == 1 &&
+		sig.Results().At(0).Type().String() == "map[string]"+hcldecImport.Path+".Spec"
+}
+
+// hasHCL2Spec tells whether the types implementing iface have an HCL2Spec
+// method.
+func hasHCL2Spec(iface *types.Interface) bool {
+	for i := 0; i < iface.NumMethods(); i++ {
+		if iface.Method(i).Name() == "HCL2Spec" {
+			return true
+		}
+	}
+	return false
+}
+
+// ctyValue is the type of the Flat fields that can be set to any HCL2 value.
+var ctyValue = types.NewNamed(
+	types.NewTypeName(token.NoPos, types.NewPackage("github.com/zclconf/go-cty/cty", "cty"), "Value", nil),
+	types.NewStruct(nil, nil), nil)
+
+// nullablePkg holds the Nullable types of the optional basic fields with
+// Options.KeepZeroValueDistinction.
+var nullablePkg = types.NewPackage("github.com/hashicorp/packer/helper/config", "config")
+
+// nullableKinds are the Nullable types, with the kind of their Value field.
+var nullableKinds = map[string]types.BasicKind{
+	"NullableBool":   types.Bool,
+	"NullableInt":    types.Int64,
+	"NullableUint":   types.Uint64,
+	"NullableFloat":  types.Float64,
+	"NullableString": types.String,
+}
+
+// makeNullable returns field as the Nullable type of its basic type along
+// with its tag. The range of the original integer type is kept in a
+// `hcl2bounds` tag for the decode layer since the Value of a NullableInt is
+// an int64.
+func makeNullable(field *types.Var, tag string) (*types.Var, string) {
+	b := field.Type().Underlying().(*types.Basic)
+	name := "NullableString"
+	switch {
+	case b.Info()&types.IsBoolean != 0:
+		name = "NullableBool"
+	case b.Info()&types.IsUnsigned != 0:
+		name = "NullableUint"
+	case b.Info()&types.IsInteger != 0:
+		name = "NullableInt"
+	case b.Info()&types.IsFloat != 0:
+		name = "NullableFloat"
+	}
+	bounds, found := unsignedBounds(b)
+	switch b.Kind() {
+	case types.Int8, types.Int16, types.Int32:
+		min, max := integerRange(b.Kind())
+		bounds, found = fmt.Sprintf("%d,%d", min, max), true
+	}
+	if found {
+		tag = strings.TrimSpace(tag + " hcl2bounds:" + strconv.Quote(bounds))
+	}
+	nullable := types.NewNamed(types.NewTypeName(token.NoPos, nullablePkg, name, nil), types.NewStruct(nil, nil), nil)
+	return types.NewField(field.Pos(), field.Pkg(), field.Name(), nullable, field.Embedded()), tag
+}
+
+// nullableValue returns the type of the Value field of t when t is one of
+// the Nullable types.
+func nullableValue(t types.Type) (*types.Basic, bool) {
+	named, isNamed := t.(*types.Named)
+	if !isNamed || named.Obj().Pkg() == nil || named.Obj().Pkg().Path() != nullablePkg.Path() {
+		return nil, false
+	}
+	kind, found := nullableKinds[named.Obj().Name()]
+	if !found {
+		return nil, false
+	}
+	return types.Typ[kind], true
+}
+
+// parseTypeOverride returns the Go type of the Flat field and the cty type of
+// the spec of a `hcl2type` tag, one of string, number, bool or a list of
+// those, ex: list(string).
+func parseTypeOverride(s string) (types.Type, cty.Type, error) {
+	var goType types.Type
+	var ctyType cty.Type
+	elem := s
+	isList := strings.HasPrefix(s, "list(") && strings.HasSuffix(s, ")")
+	if isList {
+		elem = s[len("list(") : len(s)-1]
+	}
+	switch elem {
+	case "string":
+		goType, ctyType = types.Typ[types.String], cty.String
+	case "number":
+		goType, ctyType = types.Typ[types.Float64], cty.Number
+	case "bool":
+		goType, ctyType = types.Typ[types.Bool], cty.Bool
+	default:
+		return nil, cty.NilType, fmt.Errorf("unsupported hcl2type %q", s)
+	}
+	if isList {
+		return types.NewSlice(goType), cty.List(ctyType), nil
+	}
+	return types.NewPointer(goType), ctyType, nil
+}
+
+// resolveAliases returns t with its aliases replaced by their type, those of
+// the types it is made of included, ex: []time.Duration for a []MyDur. t is
+// returned as is when it holds no alias.
+func resolveAliases(t types.Type) types.Type {
+	t = unalias(t)
+	switch t := t.(type) {
+	case *types.Pointer:
+		if elem := resolveAliases(t.Elem()); elem != t.Elem() {
+			return types.NewPointer(elem)
+		}
+	case *types.Slice:
+		if elem := resolveAliases(t.Elem()); elem != t.Elem() {
+			return types.NewSlice(elem)
+		}
+	case *types.Array:
+		if elem := resolveAliases(t.Elem()); elem != t.Elem() {
+			return types.NewArray(elem, t.Len())
+		}
+	case *types.Map:
+		key, elem := resolveAliases(t.Key()), resolveAliases(t.Elem())
+		if key != t.Key() || elem != t.Elem() {
+			return types.NewMap(key, elem)
+		}
+	}
+	return t
+}
+
+// isRune tells whether t is a rune, or a named type of a rune. go/types
+// gives the rune alias its own basic type, of the same kind as int32.
+func isRune(t types.Type) bool {
+	b, isBasic := t.Underlying().(*types.Basic)
+	return isBasic && b.Name() == "rune"
+}
+
+// isComplex tells whether t is a complex64 or a complex128, or a named type
+// of one of them.
+func isComplex(t types.Type) bool {
+	b, isBasic := t.Underlying().(*types.Basic)
+	return isBasic && b.Info()&types.IsComplex != 0
+}
+
+// isEmptyInterface tells whether t is an interface{}. Underlying resolves
+// both named types and aliases like any.
+func isEmptyInterface(t types.Type) bool {
+	i, isInterface := t.Underlying().(*types.Interface)
+	return isInterface && i.Empty()
+}
+
+func flattenNamed(f *types.Named, underlying types.Type, topPkg *types.Package, opts Options) *types.Named {
+	obj := f.Obj()
+	name := "Flat" + obj.Name()
+	if obj.Pkg() == topPkg {
+		name = flatName(obj.Name(), opts)
+	}
+	obj = types.NewTypeName(obj.Pos(), obj.Pkg(), name, obj.Type())
+	return types.NewNamed(obj, underlying, nil)
+}
+
+// flatName returns the name of the Flat version of the name type of the
+// loaded package, see Options.IncludeUnexported for unexported types.
+func flatName(name string, opts Options) string {
+	exported := token.IsExported(name)
+	name = strings.TrimPrefix(name, opts.TrimPrefix)
+	if !exported && opts.IncludeUnexported && name != "" {
+		r, size := utf8.DecodeRuneInString(name)
+		name = string(unicode.ToUpper(r)) + name[size:]
+	}
+	return "Flat" + name
+}
+
+// logger holds what the logs of the generation of a package need: the
+// FileSet of the package, and the logs themselves when they are buffered to
+// be printed once the packages generated concurrently are done, see
+// GeneratePackages.
+type logger struct {
+	fset     *token.FileSet
+	buffered bool
+	lines    []string
+}
+
+// logf logs like log.Printf, prefixed with the file:line of pos like a
+// compiler error when it is known, so that editors can jump to the field.
+func logf(l *logger, pos token.Pos, format string, args ...interface{}) {
+	if l != nil && l.fset != nil && pos.IsValid() {
+		p := l.fset.Position(pos)
+		args = append([]interface{}{p.Filename, p.Line}, args...)
+		format = "%s:%d: " + format
+	}
+	if l != nil && l.buffered {
+		l.lines = append(l.lines, fmt.Sprintf(format, args...))
+		return
+	}
+	log.Printf(format, args...)
+}
+
+func makePointer(field *types.Var) *types.Var {
+	return types.NewField(field.Pos(), field.Pkg(), field.Name(), types.NewPointer(field.Type()), field.Embedded())
+}
+
+// addFieldToStruct adds field to s, path is where s is in the logs.
+func addFieldToStruct(s *types.Struct, field *types.Var, tag string, path string, l *logger) *types.Struct {
+	sf, st := structFields(s)
+	return types.NewStruct(uniqueFields(append(sf, field), append(st, tag), path, l))
+}
+
+// squashStructs adds the fields of b to a, path is where a is in the logs.
+func squashStructs(a, b *types.Struct, path string, l *logger) *types.Struct {
+	va, ta := structFields(a)
+	vb, tb := structFields(b)
+	return types.NewStruct(uniqueFields(append(va, vb...), append(ta, tb...), path, l))
+}
+
+func uniqueFields(fields []*types.Var, tags []string, path string, l *logger) ([]*types.Var, []string) {
+	outVars := []*types.Var{}
+	outTags := []string{}
+	fieldNames := map[string]bool{}
+	for i := range fields {
+		field, tag := fields[i], tags[i]
+		if fieldNames[field.Name()] {
+			logf(l, field.Pos(), "skipping duplicate %s.%s field", path, field.Name())
+			continue
+		}
+		fieldNames[field.Name()] = true
+		outVars = append(outVars, field)
+		outTags = append(outTags, tag)
+	}
+	return outVars, outTags
+}
+
+func structFields(s *types.Struct) (vars []*types.Var, tags []string) {
+	for i := 0; i < s.NumFields(); i++ {
+		field, tag := s.Field(i), s.Tag(i)
+		vars = append(vars, field)
+		tags = append(tags, tag)
+	}
+	return vars, tags
+}
+
+// MixedCaseInitialisms are the initialisms and product names mixing upper
+// and lower case letters that ToSnakeCase keeps as one word. Its capital run
+// rule would otherwise split them in the middle, ex: IPv4 would become i_pv4
+// and MySQL my_sql. They must start with a capital, like the field names they
+// are matched in; the -initialisms flag adds to them.
+var MixedCaseInitialisms = []string{
+	"OAuth",
+	"IPv4",
+	"IPv6",
+	"MySQL",
+	"PostgreSQL",
+	"GraphQL",
+}
+
+// ToSnakeCase returns the snake_case accessor of a field name. A run of
+// capitals is an initialism, ex: HTTPPort becomes http_port, and digits stay
+// in the word they follow, ex: OAuth2Token becomes oauth2_token.
+func ToSnakeCase(str string) string {
+	runes := []rune(str)
+	var words []string
+	for i := 0; i < len(runes); {
+		if runes[i] == '_' {
+			i++
+			continue
+		}
+		j := i + 1
+		for _, initialism := range MixedCaseInitialisms {
+			if strings.HasPrefix(string(runes[i:]), initialism) {
+				j = i + len([]rune(initialism))
+				break
+			}
+		}
+		if j == i+1 && unicode.IsUpper(runes[i]) {
+			for j < len(runes) && unicode.IsUpper(runes[j]) {
+				j++
+			}
+			if j-i > 1 && j < len(runes) && unicode.IsLower(runes[j]) {
+				// the last capital starts the next word, ex: the P of HTTPPort.
+				j--
+			}
+		}
+		for j < len(runes) && unicode.IsLower(runes[j]) {
+			j++
+		}
+		for j < len(runes) && unicode.IsDigit(runes[j]) {
+			j++
+		}
+		words = append(words, strings.ToLower(string(runes[i:j])))
+		i = j
+	}
+	return strings.Join(words, "_")
+}
+
+func goFmt(b []byte, l *logger) []byte {
+	fb, err := format.Source(b)
+	if err != nil {
+		logf(l, token.NoPos, "formatting err: %v", err)
+		return b
+	}
+	return fb
+}
@@ -0,0 +1,4201 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/fatih/structtag"
+	"golang.org/x/tools/go/packages"
+)
+
+// loadTestPackage type-checks src the way packages.Load would. Tests use it
+// instead of packages.Load so that the fixtures can import the standard
+// library without compiling it.
+func loadTestPackage(t *testing.T, src string) *packages.Package {
+	t.Helper()
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "fixture.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	info := &types.Info{
+		Types: map[ast.Expr]types.TypeAndValue{},
+		Defs:  map[*ast.Ident]types.Object{},
+		Uses:  map[*ast.Ident]types.Object{},
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	pkg, err := conf.Check("fixture", fset, []*ast.File{f}, info)
+	if err != nil {
+		t.Fatalf("type check: %v", err)
+	}
+	return &packages.Package{
+		ID:        pkg.Path(),
+		Name:      pkg.Name(),
+		PkgPath:   pkg.Path(),
+		Fset:      fset,
+		Syntax:    []*ast.File{f},
+		Types:     pkg,
+		TypesInfo: info,
+	}
+}
+
+// generateTestCode returns the code generated for the Config type of src.
+func generateTestCode(t *testing.T, src string, opts Options) []byte {
+	t.Helper()
+	if len(opts.TypeNames) == 0 {
+		opts.TypeNames = []string{"Config"}
+	}
+	code, err := generate(loadTestPackage(t, src), opts)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	return code
+}
+
+// getTestStruct type-checks src and returns the package it defines along
+// with the underlying struct of the type called name.
+func getTestStruct(t *testing.T, src, name string) (*types.Package, *types.Struct) {
+	t.Helper()
+	pkg := loadTestPackage(t, src).Types
+	obj := pkg.Scope().Lookup(name)
+	if obj == nil {
+		t.Fatalf("type %s not found", name)
+	}
+	str, ok := obj.Type().Underlying().(*types.Struct)
+	if !ok {
+		t.Fatalf("%s is not a struct", name)
+	}
+	return pkg, str
+}
+
+// getTestSpecBody returns the flattened version of the type called name
+// defined in src along with its HCL2Spec body.
+func getTestSpecBody(t *testing.T, src, name string) (*types.Struct, string) {
+	t.Helper()
+	pkg, str := getTestStruct(t, src, name)
+	flat, _, err := getMapstructureSquashedStruct(pkg, str, Options{}, name, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flat = addCtyTagToStruct(flat, name, nil, Options{})
+	b := bytes.NewBuffer(nil)
+	outputStructHCL2SpecBody(b, flat)
+	return flat, b.String()
+}
+
+// runGenerated builds and runs the main package made of files and returns
+// its output; this makes sure generated code compiles. The package is
+// created in testdata so that it can use the dependencies of this module.
+func runGenerated(t *testing.T, files map[string]string) string {
+	t.Helper()
+	if err := os.MkdirAll("testdata", 0755); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("testdata", "generated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out, err := exec.Command("go", "run", "./"+filepath.ToSlash(dir)).CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s", err, out)
+	}
+	return string(out)
+}
+
+func TestUnwrap(t *testing.T) {
+	flat, body := getTestSpecBody(t, `package fixture
+
+type Opt struct{ V string }
+
+type Config struct {
+	Name Opt `+"`mapstructure:\"name,unwrap\"`"+`
+}
+`, "Config")
+
+	if flat.NumFields() != 1 {
+		t.Fatalf("expected 1 field, got %d", flat.NumFields())
+	}
+	if got := flat.Field(0).Type().String(); got != "*string" {
+		t.Fatalf("expected unwrapped *string field, got %s", got)
+	}
+	expected := `"name": &hcldec.AttrSpec{Name:"name", Type:cty.String, Required:false}`
+	if !strings.Contains(body, expected) {
+		t.Fatalf("expected %s in spec:\n%s", expected, body)
+	}
+}
+
+func TestCollapseWrappers(t *testing.T) {
+	src := `package fixture
+
+type Timeout struct{ Value string }
+
+type Ports struct{ List []int }
+
+type Validated struct{ Value string }
+
+func (v *Validated) Validate() error { return nil }
+
+type Pair struct {
+	A string
+	B string
+}
+
+type Inner struct{ Pair Pair }
+
+type Config struct {
+	Timeout   Timeout
+	Ports     *Ports
+	Validated Validated
+	Pair      Pair
+	Inner     Inner
+	Explicit  Timeout ` + "`mapstructure:\"explicit\" mapstructure-to-hcl2:\",output-only\"`" + `
+}
+`
+	pkg, str := getTestStruct(t, src, "Config")
+	flat, _, err := getMapstructureSquashedStruct(pkg, str, Options{CollapseWrappers: true}, "Config", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"Timeout":   "*string",
+		"Ports":     "[]int",
+		"Validated": "*fixture.FlatValidated",
+		"Pair":      "*fixture.FlatPair",
+		"Inner":     "*fixture.FlatInner",
+		"Explicit":  "*fixture.FlatTimeout",
+	}
+	for i := 0; i < flat.NumFields(); i++ {
+		f := flat.Field(i)
+		if want, ok := expected[f.Name()]; ok && f.Type().String() != want {
+			t.Errorf("%s: expected %s, got %s", f.Name(), want, f.Type())
+		}
+	}
+
+	flat, _, err = getMapstructureSquashedStruct(pkg, str, Options{}, "Config", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := flat.Field(0).Type().String(); got != "*fixture.FlatTimeout" {
+		t.Fatalf("expected a *fixture.FlatTimeout block without the option, got %s", got)
+	}
+}
+
+func TestUnsignedBounds(t *testing.T) {
+	flat, _ := getTestSpecBody(t, `package fixture
+
+type Config struct {
+	Small uint8
+	Port  uint16
+	Count uint
+	Delta int
+}
+`, "Config")
+
+	expected := map[string]string{
+		"Small": `hcl2bounds:"0,255"`,
+		"Port":  `hcl2bounds:"0,65535"`,
+		"Count": `hcl2bounds:"0,"`,
+	}
+	for i := 0; i < flat.NumFields(); i++ {
+		field, tag := flat.Field(i), flat.Tag(i)
+		bounds, isUnsigned := expected[field.Name()]
+		if !isUnsigned {
+			if strings.Contains(tag, "hcl2bounds") {
+				t.Fatalf("unexpected bounds on signed field %s: %s", field.Name(), tag)
+			}
+			continue
+		}
+		if !strings.Contains(tag, bounds) {
+			t.Fatalf("expected %s in %s tag, got: %s", bounds, field.Name(), tag)
+		}
+	}
+}
+
+func TestEmptyStruct(t *testing.T) {
+	src := `package main
+
+type Config struct{}
+`
+	flat, _ := getTestSpecBody(t, src, "Config")
+	code := generateCode(Options{}, "main", "fixture", []StructDef{{
+		OriginalStructName: "Config",
+		StructName:         "FlatConfig",
+		Struct:             flat,
+	}}, map[NamePath]*types.Package{})
+
+	if !bytes.Contains(code, []byte("s := map[string]hcldec.Spec{}\n")) {
+		t.Fatalf("expected an empty spec map in:\n%s", code)
+	}
+	if bytes.Contains(code, []byte("go-cty")) {
+		t.Fatalf("unexpected cty import in:\n%s", code)
+	}
+	out := runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go": `package main
+
+import "fmt"
+
+func main() {
+	fmt.Print(len((&FlatConfig{}).HCL2Spec()))
+}
+`,
+	})
+	if out != "0" {
+		t.Fatalf("expected an empty spec, got %q", out)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	code, err := Generate(Options{
+		TypeNames: []string{"Config"},
+		Patterns:  []string{"./testdata/basic"},
+	})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	for _, expected := range []string{
+		"package basic\n",
+		"type FlatConfig struct {",
+		"func (*Config) FlatMapstructure() interface{}",
+		`&hcldec.AttrSpec{Name: "name", Type: cty.String, Required: false}`,
+		`&hcldec.BlockSpec{TypeName: "nested", Nested: hcldec.ObjectSpec((*FlatNested)(nil).HCL2Spec())}`,
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+}
+
+func TestGenerate_file(t *testing.T) {
+	code, err := Generate(Options{
+		TypeNames: []string{"Config", "Nested"},
+		Patterns:  []string{"./testdata/files/config.go"},
+	})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	for _, expected := range []string{
+		"package files\n",
+		"type FlatConfig struct {",
+		"type FlatNested struct {",
+		`&hcldec.BlockSpec{TypeName: "nested", Nested: hcldec.ObjectSpec((*FlatNested)(nil).HCL2Spec())}`,
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+}
+
+func TestPackageDir(t *testing.T) {
+	expected, err := filepath.Abs("testdata/files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// like go generate ./... run from the module root.
+	if err := os.Chdir("../../.."); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	for _, pattern := range []string{
+		"./cmd/mapstructure-to-hcl2/generator/testdata/files",
+		"./cmd/mapstructure-to-hcl2/generator/testdata/files/config.go",
+	} {
+		dir, err := PackageDir(Options{Patterns: []string{pattern}})
+		if err != nil {
+			t.Fatalf("PackageDir(%s): %v", pattern, err)
+		}
+		if dir != expected {
+			t.Fatalf("PackageDir(%s): expected %s, got %s", pattern, expected, dir)
+		}
+	}
+}
+
+func TestGenerate_buildTags(t *testing.T) {
+	for tags, expectExtra := range map[string]bool{
+		"":      false,
+		"extra": true,
+	} {
+		code, err := Generate(Options{
+			TypeNames: []string{"Config"},
+			Patterns:  []string{"./testdata/tags"},
+			BuildTags: tags,
+		})
+		if err != nil {
+			t.Fatalf("Generate with tags %q: %v", tags, err)
+		}
+		if got := bytes.Contains(code, []byte(`"extra"`)); got != expectExtra {
+			t.Fatalf("with tags %q, expected the extra field to be generated: %t, in:\n%s", tags, expectExtra, code)
+		}
+	}
+}
+
+func TestGenerate_errors(t *testing.T) {
+	if _, err := Generate(Options{Patterns: []string{"./testdata/basic"}}); err == nil {
+		t.Fatal("expected an error without type names")
+	}
+	_, err := Generate(Options{
+		TypeNames: []string{"Config"},
+		Patterns:  []string{"./testdata/basic", "./testdata/nested"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "2 packages found") {
+		t.Fatalf("expected a too many packages error, got %v", err)
+	}
+
+	_, err = Generate(Options{
+		TypeNames: []string{"Config"},
+		Patterns:  []string{"./testdata/typeerror"},
+	})
+	if err == nil {
+		t.Fatal("expected an error for a package that does not type-check")
+	}
+	for _, expected := range []string{"could not be loaded", "config.go:4", "Unknown"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected %q in error: %v", expected, err)
+		}
+	}
+}
+
+func TestGenerate_invalidPackageName(t *testing.T) {
+	for _, name := range []string{"", "my-config", "type", "_"} {
+		pkg := loadTestPackage(t, `package fixture
+
+type Config struct{}
+`)
+		pkg.Name = name
+		_, err := generate(pkg, Options{TypeNames: []string{"Config"}})
+		if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("invalid package name: %q", name)) {
+			t.Fatalf("expected an invalid package name error for %q, got %v", name, err)
+		}
+	}
+}
+
+func TestAny(t *testing.T) {
+	flat, body := getTestSpecBody(t, `package fixture
+
+type Config struct {
+	Metadata interface{} `+"`mapstructure:\"metadata\"`"+`
+	UserData any         `+"`mapstructure:\"user_data\"`"+`
+}
+`, "Config")
+
+	for i := 0; i < flat.NumFields(); i++ {
+		if got := flat.Field(i).Type().String(); got != "github.com/zclconf/go-cty/cty.Value" {
+			t.Fatalf("expected %s to be a cty.Value, got %s", flat.Field(i).Name(), got)
+		}
+	}
+	for _, accessor := range []string{"metadata", "user_data"} {
+		expected := `&hcldec.AttrSpec{Name:"` + accessor + `", Type:cty.DynamicPseudoType, Required:false}`
+		if !strings.Contains(body, expected) {
+			t.Fatalf("expected %s in spec:\n%s", expected, body)
+		}
+	}
+}
+
+func TestGenerate_noFallback(t *testing.T) {
+	pkg := loadTestPackage(t, `package fixture
+
+type Config struct {
+	Name   string      `+"`mapstructure:\"name\"`"+`
+	Events chan string `+"`mapstructure:\"events\"`"+`
+}
+`)
+	opts := Options{TypeNames: []string{"Config"}}
+
+	code, err := generate(pkg, opts)
+	if err != nil {
+		t.Fatalf("lenient generation failed: %v", err)
+	}
+	if !bytes.Contains(code, []byte(typeNotFoundMarker)) {
+		t.Fatalf("expected a fallback spec in:\n%s", code)
+	}
+
+	opts.NoFallback = true
+	if _, err := generate(pkg, opts); err == nil {
+		t.Fatal("expected an error with NoFallback")
+	}
+}
+
+func TestNamedMapAndSlice(t *testing.T) {
+	_, body := getTestSpecBody(t, `package fixture
+
+type Tags map[string]string
+
+type Ports []int
+
+type Config struct {
+	Tags  Tags  `+"`mapstructure:\"tags\"`"+`
+	Ports Ports `+"`mapstructure:\"ports\"`"+`
+}
+`, "Config")
+
+	for _, expected := range []string{
+		`"tags": &hcldec.BlockAttrsSpec{TypeName:"tags", ElementType:cty.String, Required:false}`,
+		`"ports": &hcldec.AttrSpec{Name:"ports", Type:cty.List(cty.Number), Required:false}`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("expected %s in spec:\n%s", expected, body)
+		}
+	}
+}
+
+func TestValidateBounds(t *testing.T) {
+	src := `package main
+
+type Config struct {
+	Count int ` + "`mapstructure:\"count,min=1,max=10\"`" + `
+	Name  string
+}
+`
+	code := generateTestCode(t, src, Options{})
+	if !bytes.Contains(code, []byte("func (c *FlatConfig) Validate() hcl.Diagnostics {")) {
+		t.Fatalf("expected a Validate method in:\n%s", code)
+	}
+
+	out := runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go": `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("unset", (&FlatConfig{}).Validate().HasErrors())
+	for _, count := range []int{0, 1, 5, 10, 11} {
+		count := count
+		fmt.Println(count, (&FlatConfig{Count: &count}).Validate().HasErrors())
+	}
+}
+`,
+	})
+	expected := "unset false\n0 true\n1 false\n5 false\n10 false\n11 true\n"
+	if out != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+
+	_, err := generate(loadTestPackage(t, `package main
+
+type Config struct {
+	Count *int `+"`mapstructure:\"count,min=1.5\"`"+`
+}
+`), Options{TypeNames: []string{"Config"}})
+	if err == nil || !strings.Contains(err.Error(), "field Count: min 1.5 is not an integer") {
+		t.Fatalf("expected an error for a non integer bound, got %v", err)
+	}
+
+	for _, tt := range []struct{ field, expected string }{
+		{"Small uint8 `mapstructure:\"small,max=300\"`", "field Small: max 300 is out of the [0,255] range of uint8"},
+		{"Count uint  `mapstructure:\"count,min=-1\"`", "field Count: min -1 is out of the [0,18446744073709551615] range of uint"},
+	} {
+		_, err := generate(loadTestPackage(t, "package main\n\ntype Config struct {\n\t"+tt.field+"\n}\n"), Options{TypeNames: []string{"Config"}})
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Fatalf("expected the error %q, got %v", tt.expected, err)
+		}
+	}
+}
+
+func TestImportAliases(t *testing.T) {
+	src := `package main
+
+import (
+	"github.com/hashicorp/packer/cmd/mapstructure-to-hcl2/generator/testdata/imports/a/config"
+	bconfig "github.com/hashicorp/packer/cmd/mapstructure-to-hcl2/generator/testdata/imports/b/config"
+)
+
+type Config struct {
+	A config.Settings  ` + "`mapstructure:\"a\"`" + `
+	B bconfig.Settings ` + "`mapstructure:\"b\"`" + `
+}
+`
+	code := generateTestCode(t, src, Options{})
+	for _, expected := range []string{
+		`	"github.com/hashicorp/packer/cmd/mapstructure-to-hcl2/generator/testdata/imports/a/config"`,
+		`	config2 "github.com/hashicorp/packer/cmd/mapstructure-to-hcl2/generator/testdata/imports/b/config"`,
+		"A config.Settings ",
+		"B config2.Settings ",
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+
+	runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go":            "package main\n\nfunc main() { _ = FlatConfig{} }\n",
+	})
+}
+
+func TestImports_builtinTypes(t *testing.T) {
+	src := `package fixture
+
+type Config struct {
+	Err    error            ` + "`mapstructure:\"err\"`" + `
+	Errs   []error          ` + "`mapstructure:\"errs\"`" + `
+	ErrMap map[string]error ` + "`mapstructure:\"err_map\"`" + `
+}
+`
+	// error is a named type of the universe, without a package.
+	_, str := getTestStruct(t, src, "Config")
+	if imports := getUsedImports(str); len(imports) != 0 {
+		t.Fatalf("expected no import, got %v", imports)
+	}
+	code := generateTestCode(t, src, Options{})
+	expected := "import (\n\t\"github.com/hashicorp/hcl/v2/hcldec\"\n\t\"github.com/zclconf/go-cty/cty\"\n)\n"
+	if !bytes.Contains(code, []byte(expected)) {
+		t.Fatalf("expected only the hcldec and cty imports in:\n%s", code)
+	}
+}
+
+func TestNamedTypeChain(t *testing.T) {
+	_, body := getTestSpecBody(t, `package fixture
+
+type B string
+
+type A B
+
+type Config struct {
+	Value A `+"`mapstructure:\"value\"`"+`
+}
+`, "Config")
+
+	expected := `"value": &hcldec.AttrSpec{Name:"value", Type:cty.String, Required:false}`
+	if !strings.Contains(body, expected) {
+		t.Fatalf("expected %s in spec:\n%s", expected, body)
+	}
+}
+
+func TestStringEnum(t *testing.T) {
+	_, body := getTestSpecBody(t, `package fixture
+
+type LogLevel string
+
+const (
+	LogLevelDebug LogLevel = "debug"
+	LogLevelInfo  LogLevel = "info"
+)
+
+type Config struct {
+	Level    LogLevel  `+"`mapstructure:\"log_level\"`"+`
+	Fallback *LogLevel `+"`mapstructure:\"fallback_level\"`"+`
+}
+`, "Config")
+
+	for _, expected := range []string{
+		`"log_level": &hcldec.AttrSpec{Name:"log_level", Type:cty.String, Required:false}`,
+		`"fallback_level": &hcldec.AttrSpec{Name:"fallback_level", Type:cty.String, Required:false}`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("expected %s in spec:\n%s", expected, body)
+		}
+	}
+	if strings.Contains(body, "LogLevel") {
+		t.Fatalf("unexpected type name in spec:\n%s", body)
+	}
+}
+
+func TestMapstructureTagOptions(t *testing.T) {
+	flat, body := getTestSpecBody(t, `package fixture
+
+type Named struct {
+	Inner string `+"`mapstructure:\"inner,omitempty\"`"+`
+}
+
+type Anonymous struct {
+	Other string `+"`mapstructure:\"other\"`"+`
+}
+
+type Config struct {
+	Foo string    `+"`mapstructure:\"foo,omitempty\"`"+`
+	Bar Named     `+"`mapstructure:\"bar,squash\"`"+`
+	Baz Anonymous `+"`mapstructure:\",squash\"`"+`
+}
+`, "Config")
+
+	var accessors []string
+	for i := 0; i < flat.NumFields(); i++ {
+		st, err := structtag.Parse(flat.Tag(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctyTag, err := st.Get("cty")
+		if err != nil {
+			t.Fatal(err)
+		}
+		accessors = append(accessors, ctyTag.Name)
+	}
+	if got := strings.Join(accessors, ","); got != "foo,inner,other" {
+		t.Fatalf("unexpected cty accessors: %s", got)
+	}
+	if strings.Contains(body, "omitempty") || strings.Contains(body, "squash") {
+		t.Fatalf("tag options leaked into spec:\n%s", body)
+	}
+}
+
+func TestOutputOnly(t *testing.T) {
+	flat, body := getTestSpecBody(t, `package fixture
+
+type Artifact struct {
+	ID string `+"`mapstructure:\"id\"`"+`
+}
+
+type Config struct {
+	Name     string   `+"`mapstructure:\"name\"`"+`
+	Artifact Artifact `+"`mapstructure:\"artifact\" mapstructure-to-hcl2:\",output-only\"`"+`
+}
+`, "Config")
+
+	if flat.NumFields() != 2 || flat.Field(1).Name() != "Artifact" {
+		t.Fatalf("expected the Artifact field in the Flat struct, got %s", flat)
+	}
+	if !strings.Contains(body, `"name"`) {
+		t.Fatalf("expected name in spec:\n%s", body)
+	}
+	if strings.Contains(body, `"artifact"`) {
+		t.Fatalf("unexpected output only field in spec:\n%s", body)
+	}
+}
+
+func TestTrileanShape(t *testing.T) {
+	flat, body := getTestSpecBody(t, `package fixture
+
+type Trilean uint8
+
+func (t Trilean) True() bool           { return t == 1 }
+func (t Trilean) False() bool          { return t == 2 }
+func (t Trilean) ToBoolPointer() *bool { return nil }
+
+type NotTrilean uint8
+
+func (t NotTrilean) True() bool { return t == 1 }
+
+type Config struct {
+	Enabled Trilean    `+"`mapstructure:\"enabled\"`"+`
+	Level   NotTrilean `+"`mapstructure:\"level\"`"+`
+}
+`, "Config")
+
+	if got := flat.Field(0).Type().String(); got != "*bool" {
+		t.Fatalf("expected the trilean to be a *bool, got %s", got)
+	}
+	for _, expected := range []string{
+		`&hcldec.AttrSpec{Name:"enabled", Type:cty.Bool, Required:false}`,
+		`&hcldec.AttrSpec{Name:"level", Type:cty.Number, Required:false}`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("expected %s in spec:\n%s", expected, body)
+		}
+	}
+}
+
+func TestModuleTypes(t *testing.T) {
+	flat, body := getTestSpecBody(t, `package fixture
+
+import (
+	"github.com/hashicorp/packer/helper/config"
+	"github.com/hashicorp/packer/provisioner/powershell"
+)
+
+type Config struct {
+	Enabled config.Trilean             `+"`mapstructure:\"enabled\"`"+`
+	Policy  powershell.ExecutionPolicy `+"`mapstructure:\"execution_policy\"`"+`
+}
+`, "Config")
+
+	for i, expected := range []string{"*bool", "*string"} {
+		if got := flat.Field(i).Type().String(); got != expected {
+			t.Fatalf("expected %s to be a %s, got %s", flat.Field(i).Name(), expected, got)
+		}
+	}
+	for _, expected := range []string{
+		`&hcldec.AttrSpec{Name:"enabled", Type:cty.Bool, Required:false}`,
+		`&hcldec.AttrSpec{Name:"execution_policy", Type:cty.String, Required:false}`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("expected %s in spec:\n%s", expected, body)
+		}
+	}
+}
+
+func TestIsExecutionPolicy(t *testing.T) {
+	for path, expected := range map[string]bool{
+		"github.com/hashicorp/packer/provisioner/powershell": true,
+		"github.com/footplus/packer/provisioner/powershell":  true,
+		"provisioner/powershell":                             true,
+		"github.com/footplus/packer/provisioner/shell":       false,
+		"example.com/myprovisioner/powershell":               false,
+	} {
+		named := types.NewNamed(types.NewTypeName(token.NoPos, types.NewPackage(path, "powershell"), "ExecutionPolicy", nil), types.Typ[types.Int], nil)
+		if got := isExecutionPolicy(named); got != expected {
+			t.Errorf("isExecutionPolicy(%s.ExecutionPolicy) = %t, expected %t", path, got, expected)
+		}
+	}
+}
+
+func TestToCtyValue(t *testing.T) {
+	src := `package main
+
+type Disk struct {
+	Size int ` + "`mapstructure:\"size\"`" + `
+}
+
+type Network struct {
+	Name string ` + "`mapstructure:\"name\"`" + `
+}
+
+type Config struct {
+	Name     string    ` + "`mapstructure:\"name\"`" + `
+	Tags     []string  ` + "`mapstructure:\"tags\"`" + `
+	Disk     Disk      ` + "`mapstructure:\"disk\"`" + `
+	Networks []Network ` + "`mapstructure:\"networks\"`" + `
+	Unset    *Disk     ` + "`mapstructure:\"unset\"`" + `
+}
+`
+	if code := generateTestCode(t, src, Options{TypeNames: []string{"Config", "Disk", "Network"}}); bytes.Contains(code, []byte("ToCtyValue")) {
+		t.Fatalf("expected no ToCtyValue method without ToCtyValue:\n%s", code)
+	}
+	code := generateTestCode(t, src, Options{TypeNames: []string{"Config", "Disk", "Network"}, ToCtyValue: true})
+	if !bytes.Contains(code, []byte("func (c *FlatConfig) ToCtyValue() (cty.Value, error) {")) {
+		t.Fatalf("expected a ToCtyValue method in:\n%s", code)
+	}
+
+	out := runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go": `package main
+
+import (
+	"fmt"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func main() {
+	name, size, net := "a", 10, "b"
+	c := &FlatConfig{
+		Name:     &name,
+		Tags:     []string{"x", "y"},
+		Disk:     &FlatDisk{Size: &size},
+		Networks: []FlatNetwork{{Name: &net}},
+	}
+	v, err := c.ToCtyValue()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(v.GetAttr("name").AsString())
+	fmt.Println(v.GetAttr("tags").LengthInt(), v.GetAttr("tags").Index(cty.NumberIntVal(1)).AsString())
+	fmt.Println(v.GetAttr("disk").GetAttr("size").AsBigFloat().String())
+	fmt.Println(v.GetAttr("networks").Index(cty.NumberIntVal(0)).GetAttr("name").AsString())
+	fmt.Println(v.GetAttr("unset").IsNull())
+}
+`,
+	})
+	expected := "a\n2 y\n10\nb\ntrue\n"
+	if out != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+}
+
+func TestToCtyValue_base64(t *testing.T) {
+	src := `package main
+
+type Disk struct {
+	Data []byte ` + "`mapstructure:\"data\"`" + `
+}
+
+type Config struct {
+	Data  []byte ` + "`mapstructure:\"data\"`" + `
+	Unset []byte ` + "`mapstructure:\"unset\"`" + `
+	Disks []Disk ` + "`mapstructure:\"disks\"`" + `
+	Spare *Disk  ` + "`mapstructure:\"spare\"`" + `
+}
+`
+	main := `package main
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func main() {
+	c := &FlatConfig{Data: []byte("hi"), Disks: []FlatDisk{{Data: []byte("yo")}}}
+	v, err := c.ToCtyValue()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(v.Type().Equals(hcldec.ImpliedType(hcldec.ObjectSpec(c.HCL2Spec()))))
+	fmt.Println(v.GetAttr("data").AsString(), v.GetAttr("unset").IsNull(), v.GetAttr("unset").Type().FriendlyName())
+	fmt.Println(v.GetAttr("disks").Index(cty.NumberIntVal(0)).GetAttr("data").AsString())
+}
+`
+	for _, opts := range []Options{
+		{TypeNames: []string{"Config", "Disk"}, ToCtyValue: true},
+		{TypeNames: []string{"Config", "Disk"}, ToCtyValue: true, EmptySlicesAsNull: true},
+		{TypeNames: []string{"Config", "Disk"}, ToCtyValue: true, KeepZeroValueDistinction: true},
+	} {
+		code := generateTestCode(t, src, opts)
+		out := runGenerated(t, map[string]string{
+			"config.go":          src,
+			"config.hcl2spec.go": string(code),
+			"main.go":            main,
+		})
+		if expected := "true\naGk= true string\neW8=\n"; out != expected {
+			t.Fatalf("%+v: expected:\n%s\ngot:\n%s", opts, expected, out)
+		}
+	}
+}
+
+func TestDecodeCtyValue(t *testing.T) {
+	src := `package main
+
+type Disk struct {
+	Size int ` + "`mapstructure:\"size\"`" + `
+}
+
+type Network struct {
+	Name string ` + "`mapstructure:\"name\"`" + `
+}
+
+type Config struct {
+	Name     string            ` + "`mapstructure:\"name\"`" + `
+	Tags     []string          ` + "`mapstructure:\"tags\"`" + `
+	Metadata map[string]string ` + "`mapstructure:\"metadata\"`" + `
+	Disk     Disk              ` + "`mapstructure:\"disk\"`" + `
+	Networks []Network         ` + "`mapstructure:\"networks\"`" + `
+	Unset    *Disk             ` + "`mapstructure:\"unset\"`" + `
+}
+`
+	opts := Options{TypeNames: []string{"Config", "Disk", "Network"}, DecodeCtyValue: true}
+	code := generateTestCode(t, src, opts)
+	if !bytes.Contains(code, []byte("func (*FlatConfig) DecodeCtyValue(val cty.Value) (*FlatConfig, error) {")) {
+		t.Fatalf("expected a DecodeCtyValue method in:\n%s", code)
+	}
+
+	out := runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go": `package main
+
+import (
+	"fmt"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func main() {
+	c, err := (*FlatConfig)(nil).DecodeCtyValue(cty.ObjectVal(map[string]cty.Value{
+		"name":     cty.StringVal("a"),
+		"tags":     cty.ListVal([]cty.Value{cty.StringVal("x"), cty.StringVal("y")}),
+		"metadata": cty.MapVal(map[string]cty.Value{"k": cty.StringVal("v")}),
+		"disk":     cty.ObjectVal(map[string]cty.Value{"size": cty.NumberIntVal(10)}),
+		"networks": cty.TupleVal([]cty.Value{
+			cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal("b")}),
+		}),
+	}))
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(*c.Name, c.Tags, c.Metadata["k"], *c.Disk.Size, *c.Networks[0].Name, c.Unset == nil)
+
+	_, err = (*FlatConfig)(nil).DecodeCtyValue(cty.ObjectVal(map[string]cty.Value{
+		"nmae": cty.StringVal("a"),
+	}))
+	fmt.Println(err != nil)
+}
+`,
+	})
+	expected := "a [x y] v 10 b true\ntrue\n"
+	if out != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+}
+
+func TestDecodeCtyValue_base64(t *testing.T) {
+	src := `package main
+
+type Disk struct {
+	Data []byte ` + "`mapstructure:\"data\"`" + `
+}
+
+type Config struct {
+	Data  []byte ` + "`mapstructure:\"data\"`" + `
+	Disks []Disk ` + "`mapstructure:\"disks\"`" + `
+}
+`
+	main := `package main
+
+import (
+	"fmt"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func main() {
+	c, err := (*FlatConfig)(nil).DecodeCtyValue(cty.ObjectVal(map[string]cty.Value{
+		"data": cty.StringVal("aGk="),
+		"disks": cty.TupleVal([]cty.Value{
+			cty.ObjectVal(map[string]cty.Value{"data": cty.StringVal("eW8=")}),
+		}),
+	}))
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(c.Data), string(c.Disks[0].Data))
+
+	_, err = (*FlatConfig)(nil).DecodeCtyValue(cty.ObjectVal(map[string]cty.Value{
+		"data": cty.StringVal("hi!"),
+	}))
+	fmt.Println(err)
+}
+`
+	for _, opts := range []Options{
+		{TypeNames: []string{"Config", "Disk"}, DecodeCtyValue: true},
+		{TypeNames: []string{"Config", "Disk"}, DecodeCtyValue: true, KeepZeroValueDistinction: true},
+	} {
+		code := generateTestCode(t, src, opts)
+		out := runGenerated(t, map[string]string{
+			"config.go":          src,
+			"config.hcl2spec.go": string(code),
+			"main.go":            main,
+		})
+		if expected := "hi yo\nmust be base64 encoded: illegal base64 data at input byte 2\n"; out != expected {
+			t.Fatalf("%+v: expected:\n%s\ngot:\n%s", opts, expected, out)
+		}
+	}
+}
+
+func TestToCtyValue_emptySlices(t *testing.T) {
+	src := `package main
+
+type Config struct {
+	Unset []string ` + "`mapstructure:\"unset\"`" + `
+	Empty []string ` + "`mapstructure:\"empty\"`" + `
+}
+`
+	main := `package main
+
+import "fmt"
+
+func main() {
+	v, err := (&FlatConfig{Empty: []string{}}).ToCtyValue()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(v.GetAttr("unset").IsNull(), v.GetAttr("empty").IsNull())
+}
+`
+	for _, tc := range []struct {
+		opts     Options
+		expected string
+	}{
+		{Options{ToCtyValue: true}, "true false\n"},
+		{Options{ToCtyValue: true, EmptySlicesAsNull: true}, "true true\n"},
+	} {
+		code := generateTestCode(t, src, tc.opts)
+		out := runGenerated(t, map[string]string{
+			"config.go":          src,
+			"config.hcl2spec.go": string(code),
+			"main.go":            main,
+		})
+		if out != tc.expected {
+			t.Fatalf("%+v: expected:\n%s\ngot:\n%s", tc.opts, tc.expected, out)
+		}
+	}
+}
+
+func TestAnonymousStruct(t *testing.T) {
+	src := `package main
+
+type Config struct {
+	Opts struct {
+		Name  string ` + "`mapstructure:\"name\"`" + `
+		Inner *struct {
+			Size int ` + "`mapstructure:\"size\"`" + `
+		} ` + "`mapstructure:\"inner\"`" + `
+	} ` + "`mapstructure:\"opts\"`" + `
+	Rules []struct {
+		Port int ` + "`mapstructure:\"port\"`" + `
+	} ` + "`mapstructure:\"rules\"`" + `
+}
+`
+	code := generateTestCode(t, src, Options{})
+	for _, expected := range []string{
+		"type FlatConfigOpts struct {",
+		"type FlatConfigOptsInner struct {",
+		"type FlatConfigRules struct {",
+		"Opts  *FlatConfigOpts ",
+		"Inner *FlatConfigOptsInner ",
+		"Rules []FlatConfigRules ",
+		`Nested: hcldec.ObjectSpec((*FlatConfigOpts)(nil).HCL2Spec())`,
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+	if bytes.Contains(code, []byte("struct{")) {
+		t.Fatalf("expected no anonymous struct in:\n%s", code)
+	}
+
+	out := runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go": `package main
+
+import "fmt"
+
+func main() {
+	spec := (&FlatConfig{}).HCL2Spec()
+	fmt.Println(len(spec), len((&FlatConfigOpts{}).HCL2Spec()))
+}
+`,
+	})
+	if expected := "2 2\n"; out != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+}
+
+func TestValidateUnique(t *testing.T) {
+	src := `package main
+
+type Config struct {
+	SecurityGroupIDs []string ` + "`mapstructure:\"security_group_ids,unique\"`" + `
+	Tags             []string ` + "`mapstructure:\"tags\"`" + `
+}
+`
+	code := generateTestCode(t, src, Options{})
+	if !bytes.Contains(code, []byte("func (c *FlatConfig) Validate() hcl.Diagnostics {")) {
+		t.Fatalf("expected a Validate method in:\n%s", code)
+	}
+
+	out := runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go": `package main
+
+import "fmt"
+
+func main() {
+	for _, ids := range [][]string{nil, {"sg-1", "sg-2"}, {"sg-1", "sg-2", "sg-1"}} {
+		fmt.Println(len((&FlatConfig{SecurityGroupIDs: ids}).Validate()))
+	}
+	fmt.Println(len((&FlatConfig{Tags: []string{"a", "a"}}).Validate()))
+}
+`,
+	})
+	expected := "0\n0\n1\n0\n"
+	if out != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+}
+
+func TestByteSlice(t *testing.T) {
+	flat, body := getTestSpecBody(t, `package fixture
+
+type Data []byte
+
+type Config struct {
+	UserData []byte `+"`mapstructure:\"user_data\"`"+`
+	Blob     Data   `+"`mapstructure:\"blob\"`"+`
+	Ports    []int  `+"`mapstructure:\"ports\"`"+`
+}
+`, "Config")
+
+	for _, expected := range []string{
+		`&hcldec.AttrSpec{Name:"user_data", Type:cty.String, Required:false}`,
+		`&hcldec.AttrSpec{Name:"blob", Type:cty.String, Required:false}`,
+		`&hcldec.AttrSpec{Name:"ports", Type:cty.List(cty.Number), Required:false}`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("expected %s in spec:\n%s", expected, body)
+		}
+	}
+	for i := 0; i < flat.NumFields(); i++ {
+		field, tag := flat.Field(i), flat.Tag(i)
+		if isBase64 := strings.Contains(tag, `hcl2encoding:"base64"`); isBase64 != (field.Name() != "Ports") {
+			t.Fatalf("unexpected base64 encoding tag for %s: %s", field.Name(), tag)
+		}
+	}
+}
+
+func TestSquashEmbedded(t *testing.T) {
+	src := `package main
+
+type Common struct {
+	Region string ` + "`mapstructure:\"region\"`" + `
+}
+
+type Extra struct {
+	Zone string ` + "`mapstructure:\"zone\"`" + `
+}
+
+type Named struct {
+	Size int ` + "`mapstructure:\"size\"`" + `
+}
+
+type Config struct {
+	Common
+	*Extra
+	Named ` + "`mapstructure:\"named\"`" + `
+	Name  string ` + "`mapstructure:\"name\"`" + `
+}
+`
+	code := generateTestCode(t, src, Options{TypeNames: []string{"Config", "Named"}})
+	if !bytes.Contains(code, []byte(`TypeName: "common"`)) {
+		t.Fatalf("expected a common block without SquashEmbedded in:\n%s", code)
+	}
+
+	code = generateTestCode(t, src, Options{TypeNames: []string{"Config", "Named"}, SquashEmbedded: true})
+	for _, expected := range []string{
+		`&hcldec.AttrSpec{Name: "region", Type: cty.String, Required: false}`,
+		`&hcldec.AttrSpec{Name: "zone", Type: cty.String, Required: false}`,
+		`&hcldec.BlockSpec{TypeName: "named", Nested: hcldec.ObjectSpec((*FlatNamed)(nil).HCL2Spec())}`,
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+	for _, unexpected := range []string{`"common"`, `"extra"`} {
+		if bytes.Contains(code, []byte(unexpected)) {
+			t.Fatalf("unexpected %s in:\n%s", unexpected, code)
+		}
+	}
+}
+
+func TestInclude(t *testing.T) {
+	_, body := getTestSpecBody(t, `package fixture
+
+import "github.com/hashicorp/packer/cmd/mapstructure-to-hcl2/generator/testdata/include/base"
+
+var _ base.Base
+
+type Windows struct {
+	WinRMUser string `+"`mapstructure:\"winrm_user\"`"+`
+}
+
+type Config struct {
+	Name string   `+"`mapstructure:\"name\"`"+`
+	_    struct{} `+"`mapstructure:\",include=base.Base\"`"+`
+	_    struct{} `+"`mapstructure:\",include=Windows\"`"+`
+}
+`, "Config")
+
+	for _, expected := range []string{
+		`&hcldec.AttrSpec{Name:"name", Type:cty.String, Required:false}`,
+		`&hcldec.AttrSpec{Name:"region", Type:cty.String, Required:false}`,
+		`&hcldec.AttrSpec{Name:"winrm_user", Type:cty.String, Required:false}`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("expected %s in spec:\n%s", expected, body)
+		}
+	}
+}
+
+func TestSquashOtherPackage(t *testing.T) {
+	code := string(generateTestCode(t, `package fixture
+
+import "github.com/hashicorp/packer/cmd/mapstructure-to-hcl2/generator/testdata/squash/common"
+
+type Config struct {
+	common.Common `+"`mapstructure:\",squash\"`"+`
+	Name          string `+"`mapstructure:\"name\"`"+`
+}
+`, Options{}))
+
+	// the promoted fields keep the types of their package, and so their
+	// imports.
+	for _, expected := range []string{
+		`	"github.com/hashicorp/packer/cmd/mapstructure-to-hcl2/generator/testdata/external"`,
+		`	"github.com/hashicorp/packer/cmd/mapstructure-to-hcl2/generator/testdata/squash/common"`,
+		"Mode     *common.Mode ",
+		"Disks    []common.FlatDisk ",
+		"Timeout  *string ",
+		"External *external.Mode ",
+		"Nested   *external.FlatNested ",
+		"Name     *string ",
+		`"nested":   &hcldec.BlockSpec{TypeName: "nested", Nested: hcldec.ObjectSpec((*external.FlatNested)(nil).HCL2Spec())}`,
+	} {
+		if !strings.Contains(code, expected) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+}
+
+func TestSquashFieldOrder(t *testing.T) {
+	src := `package fixture
+
+type Nested struct {
+	Zone string ` + "`mapstructure:\"zone\"`" + `
+}
+
+type Common struct {
+	Region string ` + "`mapstructure:\"region\"`" + `
+	Nested ` + "`mapstructure:\",squash\"`" + `
+	Token  string ` + "`mapstructure:\"token\"`" + `
+}
+
+type Config struct {
+	Name   string ` + "`mapstructure:\"name\"`" + `
+	Common ` + "`mapstructure:\",squash\"`" + `
+	Count  int    ` + "`mapstructure:\"count\"`" + `
+}
+`
+	// the squashed fields are where the embedded struct is, like Go
+	// promotes them.
+	expected := []string{"Name", "Region", "Zone", "Token", "Count"}
+	flat, _ := getTestSpecBody(t, src, "Config")
+	var got []string
+	for i := 0; i < flat.NumFields(); i++ {
+		got = append(got, flat.Field(i).Name())
+	}
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected fields %v, got %v", expected, got)
+	}
+
+	code := string(generateTestCode(t, src, Options{}))
+	last := -1
+	for _, name := range expected {
+		i := strings.Index(code, "\t"+name+" ")
+		if i < last {
+			t.Fatalf("expected %s after the previous fields in:\n%s", name, code)
+		}
+		last = i
+	}
+}
+
+func TestSquashPointer(t *testing.T) {
+	_, body := getTestSpecBody(t, `package fixture
+
+type Common struct {
+	Region string `+"`mapstructure:\"region\"`"+`
+}
+
+type Other struct {
+	Zone string `+"`mapstructure:\"zone\"`"+`
+}
+
+type Config struct {
+	*Common `+"`mapstructure:\",squash\"`"+`
+	Other   *Other `+"`mapstructure:\",squash\"`"+`
+	Name    string `+"`mapstructure:\"name\"`"+`
+}
+`, "Config")
+
+	for _, expected := range []string{
+		`&hcldec.AttrSpec{Name:"region", Type:cty.String, Required:false}`,
+		`&hcldec.AttrSpec{Name:"zone", Type:cty.String, Required:false}`,
+		`&hcldec.AttrSpec{Name:"name", Type:cty.String, Required:false}`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("expected %s in spec:\n%s", expected, body)
+		}
+	}
+}
+
+func TestNamedBool(t *testing.T) {
+	src := `package main
+
+type Flag bool
+
+type Config struct {
+	SkipCleanup Flag ` + "`mapstructure:\"skip_cleanup\"`" + `
+}
+`
+	code := generateTestCode(t, src, Options{})
+	for _, expected := range []string{
+		"SkipCleanup *Flag `mapstructure:\"skip_cleanup\" cty:\"skip_cleanup\"`",
+		`"skip_cleanup": &hcldec.AttrSpec{Name: "skip_cleanup", Type: cty.Bool, Required: false}`,
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+
+	out := runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go": `package main
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty/gocty"
+)
+
+func main() {
+	for _, src := range []string{"skip_cleanup = true\n", ""} {
+		f, diags := hclsyntax.ParseConfig([]byte(src), "config.hcl", hcl.Pos{Line: 1, Column: 1})
+		if diags.HasErrors() {
+			panic(diags)
+		}
+		val, diags := hcldec.Decode(f.Body, hcldec.ObjectSpec((&FlatConfig{}).HCL2Spec()), nil)
+		if diags.HasErrors() {
+			panic(diags)
+		}
+		var c FlatConfig
+		if err := gocty.FromCtyValue(val, &c); err != nil {
+			panic(err)
+		}
+		fmt.Println(c.SkipCleanup != nil && bool(*c.SkipCleanup))
+	}
+}
+`,
+	})
+	expected := "true\nfalse\n"
+	if out != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+}
+
+func TestInterface(t *testing.T) {
+	logs := bytes.NewBuffer(nil)
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	flat, body := getTestSpecBody(t, `package fixture
+
+import "io"
+
+type Config struct {
+	Name   string    `+"`mapstructure:\"name\"`"+`
+	Reader io.Reader `+"`mapstructure:\"reader\"`"+`
+}
+`, "Config")
+
+	if flat.NumFields() != 1 {
+		t.Fatalf("expected the interface to be skipped, got %s", flat)
+	}
+	if strings.Contains(body, `"reader"`) {
+		t.Fatalf("unexpected interface in spec:\n%s", body)
+	}
+	if !strings.Contains(logs.String(), "skipping field Config.Reader: io.Reader is an interface") {
+		t.Fatalf("expected a log about Reader, got: %q", logs.String())
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	src := `package main
+
+const (
+	DefaultUser  = "root"
+	DefaultPort  = 22
+	DefaultRatio = 0.5
+)
+
+type Config struct {
+	User   string  ` + "`mapstructure:\"user,default=DefaultUser\"`" + `
+	Port   int     ` + "`mapstructure:\"port,default=DefaultPort\"`" + `
+	Ratio  float64 ` + "`mapstructure:\"ratio,default=DefaultRatio\"`" + `
+	Shell  string  ` + "`mapstructure:\"shell,default=/bin/sh\"`" + `
+	Enable bool    ` + "`mapstructure:\"enable,default=true\"`" + `
+	Name   string  ` + "`mapstructure:\"name\"`" + `
+}
+`
+	code := generateTestCode(t, src, Options{})
+	for _, expected := range []string{
+		`"user":   cty.StringVal("root"),`,
+		`"port":   cty.MustParseNumberVal("22"),`,
+		`"ratio":  cty.MustParseNumberVal("0.5"),`,
+		`"shell":  cty.StringVal("/bin/sh"),`,
+		`"enable": cty.BoolVal(true),`,
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+	if bytes.Contains(code, []byte(`"name":   cty.`)) {
+		t.Fatalf("unexpected default for name in:\n%s", code)
+	}
+
+	out := runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go": `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println(len((&FlatConfig{}).Defaults()))
+}
+`,
+	})
+	if out != "5\n" {
+		t.Fatalf("expected 5 defaults, got %s", out)
+	}
+
+	_, err := generate(loadTestPackage(t, `package main
+
+type Config struct {
+	Port int `+"`mapstructure:\"port,default=DefaultPort\"`"+`
+}
+`), Options{TypeNames: []string{"Config"}})
+	if err == nil || !strings.Contains(err.Error(), "default DefaultPort is not a number") {
+		t.Fatalf("expected an error for an unknown constant, got %v", err)
+	}
+}
+
+func TestDefaults_boolSpellings(t *testing.T) {
+	src := `package main
+
+type Config struct {
+	Enable  bool ` + "`mapstructure:\"enable\" default:\"1\"`" + `
+	Verbose bool ` + "`mapstructure:\"verbose,default=F\"`" + `
+}
+`
+	code := generateTestCode(t, src, Options{})
+	for _, expected := range []string{
+		`"enable":  cty.BoolVal(true),`,
+		`"verbose": cty.BoolVal(false),`,
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+
+	out := runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go": `package main
+
+import "fmt"
+
+func main() {
+	c := &FlatConfig{}
+	c.ApplyDefaults()
+	fmt.Println(*c.Enable, *c.Verbose)
+}
+`,
+	})
+	if out != "true false\n" {
+		t.Fatalf("expected the defaults to be set as Go bools, got %s", out)
+	}
+}
+
+func TestApplyDefaults(t *testing.T) {
+	src := `package main
+
+type Config struct {
+	User    string ` + "`mapstructure:\"user\" default:\"root\"`" + `
+	Port    int    ` + "`mapstructure:\"port\" default:\"22\"`" + `
+	Timeout int    ` + "`mapstructure:\"timeout\" default:\"60\"`" + `
+	Enable  bool   ` + "`mapstructure:\"enable\" default:\"true\"`" + `
+	Shell   string ` + "`mapstructure:\"shell,default=/bin/sh\"`" + `
+	Name    string ` + "`mapstructure:\"name\"`" + `
+}
+`
+	code := generateTestCode(t, src, Options{})
+	if !bytes.Contains(code, []byte("func (c *FlatConfig) ApplyDefaults() {")) {
+		t.Fatalf("expected an ApplyDefaults method in:\n%s", code)
+	}
+
+	out := runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go": `package main
+
+import "fmt"
+
+func main() {
+	user, port, enable := "admin", 2222, false
+	c := &FlatConfig{User: &user, Port: &port, Enable: &enable}
+	c.ApplyDefaults()
+	fmt.Println(*c.User, *c.Port, *c.Timeout, *c.Enable, *c.Shell, c.Name == nil)
+}
+`,
+	})
+	if out != "admin 2222 60 false /bin/sh true\n" {
+		t.Fatalf("expected defaults to only be applied to unset fields, got %s", out)
+	}
+
+	_, err := generate(loadTestPackage(t, `package main
+
+type Config struct {
+	Port int `+"`mapstructure:\"port\" default:\"1.5\"`"+`
+}
+`), Options{TypeNames: []string{"Config"}})
+	if err == nil || !strings.Contains(err.Error(), "default 1.5 is not an integer") {
+		t.Fatalf("expected an error for a non integer default, got %v", err)
+	}
+}
+
+func TestLintSelfDefined(t *testing.T) {
+	logs := bytes.NewBuffer(nil)
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	src := `package fixture
+
+import "github.com/hashicorp/hcl/v2/hcldec"
+
+type Custom struct{ Name string }
+
+func (*Custom) HCL2Spec() map[string]hcldec.Spec { return nil }
+
+type Config struct {
+	Untagged Custom ` + "`mapstructure:\"untagged\"`" + `
+	Tagged   Custom ` + "`mapstructure:\"tagged\" mapstructure-to-hcl2:\",self-defined\"`" + `
+}
+`
+	code := generateTestCode(t, src, Options{LintSelfDefined: true})
+	expected := "field Config.Untagged: fixture.Custom has a HCL2Spec method but is flattened"
+	if !strings.Contains(logs.String(), expected) {
+		t.Fatalf("expected a warning about Untagged, got: %q", logs.String())
+	}
+	if strings.Contains(logs.String(), "Config.Tagged") {
+		t.Fatalf("unexpected warning about Tagged: %q", logs.String())
+	}
+	for _, expected := range []string{
+		"Untagged *FlatCustom ",
+		"Tagged   *Custom ",
+		`"tagged":   &hcldec.BlockSpec{TypeName: "tagged", Nested: hcldec.ObjectSpec((&Custom{}).HCL2Spec())},`,
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+
+	logs.Reset()
+	generateTestCode(t, src, Options{})
+	if strings.Contains(logs.String(), "HCL2Spec method") {
+		t.Fatalf("unexpected warning without LintSelfDefined: %q", logs.String())
+	}
+}
+
+func TestLogPaths(t *testing.T) {
+	logs := bytes.NewBuffer(nil)
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	generateTestCode(t, `package fixture
+
+import "io"
+
+type Network struct {
+	Reader io.Reader `+"`mapstructure:\"reader\"`"+`
+}
+
+type CommonConfig struct {
+	Network `+"`mapstructure:\",squash\"`"+`
+	Name    string `+"`mapstructure:\"name\"`"+`
+}
+
+type Config struct {
+	CommonConfig `+"`mapstructure:\",squash\"`"+`
+	Name         string `+"`mapstructure:\"name\"`"+`
+}
+`, Options{})
+
+	for _, expected := range []string{
+		"skipping field Config.CommonConfig.Network.Reader: io.Reader is an interface",
+		"skipping duplicate Config.Name field",
+	} {
+		if !strings.Contains(logs.String(), expected) {
+			t.Fatalf("expected %q in logs:\n%s", expected, logs.String())
+		}
+	}
+}
+
+func TestSliceOfMaps(t *testing.T) {
+	src := `package main
+
+type Labels map[string]string
+
+type Config struct {
+	Tags   []map[string]string ` + "`mapstructure:\"tags\"`" + `
+	Ports  []map[string]int    ` + "`mapstructure:\"ports\"`" + `
+	Labels []Labels            ` + "`mapstructure:\"labels\"`" + `
+}
+`
+	code := generateTestCode(t, src, Options{})
+	for _, expected := range []string{
+		`"tags":   &hcldec.AttrSpec{Name: "tags", Type: cty.List(cty.Map(cty.String)), Required: false}`,
+		`"ports":  &hcldec.AttrSpec{Name: "ports", Type: cty.List(cty.Map(cty.Number)), Required: false}`,
+		`"labels": &hcldec.AttrSpec{Name: "labels", Type: cty.List(cty.Map(cty.String)), Required: false}`,
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+
+	out := runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go": `package main
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty/gocty"
+)
+
+func main() {
+	src := "tags = [{ a = \"1\" }, { b = \"2\", c = \"3\" }]\n" +
+		"ports = [{ ssh = 22 }, { http = 80 }]\n" +
+		"labels = [{ env = \"prod\" }]\n"
+	f, diags := hclsyntax.ParseConfig([]byte(src), "config.hcl", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		panic(diags)
+	}
+	val, diags := hcldec.Decode(f.Body, hcldec.ObjectSpec((&FlatConfig{}).HCL2Spec()), nil)
+	if diags.HasErrors() {
+		panic(diags)
+	}
+	var c FlatConfig
+	if err := gocty.FromCtyValue(val, &c); err != nil {
+		panic(err)
+	}
+	fmt.Println(len(c.Tags), c.Tags[0]["a"], c.Tags[1]["b"], c.Tags[1]["c"])
+	fmt.Println(len(c.Ports), c.Ports[0]["ssh"], c.Ports[1]["http"], c.Labels[0]["env"])
+}
+`,
+	})
+	if out != "2 1 2 3\n2 22 80 prod\n" {
+		t.Fatalf("unexpected output: %s", out)
+	}
+}
+
+func TestRequiredFromNonPointer(t *testing.T) {
+	src := `package main
+
+type Mode string
+
+type Config struct {
+	Name string ` + "`mapstructure:\"name\"`" + `
+	Mode Mode   ` + "`mapstructure:\"mode\"`" + `
+	Port *int   ` + "`mapstructure:\"port\"`" + `
+}
+`
+	code := generateTestCode(t, src, Options{})
+	for _, expected := range []string{
+		"Name *string ",
+		"Mode *Mode ",
+		"Port *int ",
+		`"name": &hcldec.AttrSpec{Name: "name", Type: cty.String, Required: false}`,
+		`"mode": &hcldec.AttrSpec{Name: "mode", Type: cty.String, Required: false}`,
+		`"port": &hcldec.AttrSpec{Name: "port", Type: cty.Number, Required: false}`,
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %s without RequiredFromNonPointer in:\n%s", expected, code)
+		}
+	}
+
+	code = generateTestCode(t, src, Options{RequiredFromNonPointer: true})
+	for _, expected := range []string{
+		"Name string ",
+		"Mode Mode ",
+		"Port *int ",
+		`"name": &hcldec.AttrSpec{Name: "name", Type: cty.String, Required: true}`,
+		`"mode": &hcldec.AttrSpec{Name: "mode", Type: cty.String, Required: true}`,
+		`"port": &hcldec.AttrSpec{Name: "port", Type: cty.Number, Required: false}`,
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %s with RequiredFromNonPointer in:\n%s", expected, code)
+		}
+	}
+
+	out := runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go": `package main
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+func main() {
+	for _, src := range []string{"name = \"a\"\nmode = \"b\"\n", "name = \"a\"\nport = 22\n"} {
+		f, diags := hclsyntax.ParseConfig([]byte(src), "config.hcl", hcl.Pos{Line: 1, Column: 1})
+		if diags.HasErrors() {
+			panic(diags)
+		}
+		_, diags = hcldec.Decode(f.Body, hcldec.ObjectSpec((&FlatConfig{}).HCL2Spec()), nil)
+		fmt.Println(diags.HasErrors())
+	}
+}
+`,
+	})
+	if out != "false\ntrue\n" {
+		t.Fatalf("expected the missing mode to be an error, got:\n%s", out)
+	}
+}
+
+func TestSquashSelfDefinedSpec(t *testing.T) {
+	src := `package main
+
+import (
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/zclconf/go-cty/cty"
+)
+
+type Common struct {
+	Region string ` + "`mapstructure:\"region\"`" + `
+}
+
+func (*Common) HCL2Spec() map[string]hcldec.Spec {
+	return map[string]hcldec.Spec{
+		"region": &hcldec.AttrSpec{Name: "region", Type: cty.String, Required: true},
+	}
+}
+
+type Config struct {
+	Common ` + "`mapstructure:\",squash\"`" + `
+	Name   string ` + "`mapstructure:\"name\"`" + `
+}
+`
+	code := generateTestCode(t, src, Options{})
+	for _, expected := range []string{
+		"Region *string ",
+		"for k, v := range (&Common{}).HCL2Spec() {",
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+
+	out := runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go": `package main
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+)
+
+func main() {
+	spec := (&FlatConfig{}).HCL2Spec()
+	fmt.Println(len(spec), spec["region"].(*hcldec.AttrSpec).Required, spec["name"].(*hcldec.AttrSpec).Required)
+}
+`,
+	})
+	if out != "2 true false\n" {
+		t.Fatalf("expected the spec of Common to be merged, got:\n%s", out)
+	}
+}
+
+func TestIterSeq(t *testing.T) {
+	flat, body := getTestSpecBody(t, `package fixture
+
+import "iter"
+
+type Config struct {
+	Name  string           `+"`mapstructure:\"name\"`"+`
+	Names iter.Seq[string] `+"`mapstructure:\"names\"`"+`
+}
+`, "Config")
+
+	if flat.NumFields() != 1 {
+		t.Fatalf("expected the iterator to be skipped, got %s", flat)
+	}
+	if strings.Contains(body, `"names"`) {
+		t.Fatalf("unexpected iterator in spec:\n%s", body)
+	}
+}
+
+func TestImpl(t *testing.T) {
+	_, body := getTestSpecBody(t, `package fixture
+
+import "github.com/hashicorp/packer/cmd/mapstructure-to-hcl2/generator/testdata/impl/comm"
+
+type Config struct {
+	Comm comm.Communicator `+"`mapstructure:\"communicator,impl=github.com/hashicorp/packer/cmd/mapstructure-to-hcl2/generator/testdata/impl/ssh.Config\"`"+`
+}
+`, "Config")
+
+	// ssh is only imported by comm.
+	expected := `"communicator": &hcldec.BlockSpec{TypeName: "communicator", Nested: hcldec.ObjectSpec((*github.com/hashicorp/packer/cmd/mapstructure-to-hcl2/generator/testdata/impl/ssh.FlatConfig)(nil).HCL2Spec())}`
+	if !strings.Contains(body, expected) {
+		t.Fatalf("expected %s in spec:\n%s", expected, body)
+	}
+
+	for _, ref := range []string{"ssh.Config", "example.com/ssh.Config", "github.com/hashicorp/packer/cmd/mapstructure-to-hcl2/generator/testdata/impl/ssh.Confog"} {
+		src := `package fixture
+
+import "github.com/hashicorp/packer/cmd/mapstructure-to-hcl2/generator/testdata/impl/comm"
+
+type Config struct {
+	Comm comm.Communicator ` + "`mapstructure:\"communicator,impl=" + ref + "\"`" + `
+}
+`
+		if _, err := generate(loadTestPackage(t, src), Options{TypeNames: []string{"Config"}}); err == nil {
+			t.Fatalf("expected an error for impl=%s", ref)
+		}
+	}
+}
+
+func TestImplSlice(t *testing.T) {
+	src := `package main
+
+type Provisioner interface {
+	Prepare() error
+}
+
+type Shell struct {
+	Inline []string ` + "`mapstructure:\"inline\"`" + `
+}
+
+func (*Shell) Prepare() error { return nil }
+
+type Config struct {
+	Provisioners []Provisioner ` + "`mapstructure:\"provisioner,impl=fixture.Shell\"`" + `
+}
+`
+	code := generateTestCode(t, src, Options{TypeNames: []string{"Config", "Shell"}})
+	for _, expected := range []string{
+		"Provisioners []FlatShell ",
+		`"provisioner": &hcldec.BlockListSpec{TypeName: "provisioner", Nested: hcldec.ObjectSpec((*FlatShell)(nil).HCL2Spec())}`,
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+
+	out := runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go": `package main
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty/gocty"
+)
+
+func main() {
+	f, diags := hclsyntax.ParseConfig([]byte("provisioner {\n  inline = [\"a\"]\n}\nprovisioner {\n  inline = [\"b\", \"c\"]\n}\n"), "config.pkr.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		panic(diags)
+	}
+	c := &FlatConfig{}
+	val, diags := hcldec.Decode(f.Body, hcldec.ObjectSpec(c.HCL2Spec()), nil)
+	if diags.HasErrors() {
+		panic(diags)
+	}
+	if err := gocty.FromCtyValue(val, c); err != nil {
+		panic(err)
+	}
+	for _, p := range c.Provisioners {
+		fmt.Println(p.Inline)
+	}
+}
+`,
+	})
+	if expected := "[a]\n[b c]\n"; out != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+
+	src = strings.Replace(src, "func (*Shell) Prepare() error { return nil }", "", 1)
+	_, err := generate(loadTestPackage(t, src), Options{TypeNames: []string{"Config"}})
+	if err == nil || !strings.Contains(err.Error(), "impl fixture.Shell does not implement fixture.Provisioner") {
+		t.Fatalf("expected a does not implement error, got %v", err)
+	}
+}
+
+func TestGenerate_typeNotFound(t *testing.T) {
+	src := `package fixture
+
+type Config struct {
+	Name string ` + "`mapstructure:\"name\"`" + `
+}
+`
+	logs := bytes.NewBuffer(nil)
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	code := generateTestCode(t, src, Options{TypeNames: []string{"Config", "Confog"}})
+	if !bytes.Contains(code, []byte("type FlatConfig struct {")) {
+		t.Fatalf("expected FlatConfig in:\n%s", code)
+	}
+	if !strings.Contains(logs.String(), "type(s) not found in fixture: Confog") {
+		t.Fatalf("expected a warning about Confog, got: %q", logs.String())
+	}
+
+	_, err := generate(loadTestPackage(t, src), Options{TypeNames: []string{"Config", "Confog"}, Strict: true})
+	if err == nil || !strings.Contains(err.Error(), "Confog") {
+		t.Fatalf("expected a not found error for Confog, got %v", err)
+	}
+}
+
+func TestEmitHCLTags(t *testing.T) {
+	src := `package main
+
+type Nested struct {
+	Value string ` + "`mapstructure:\"value\"`" + `
+}
+
+type Config struct {
+	Name    string   ` + "`mapstructure:\"name\"`" + `
+	Nested  Nested   ` + "`mapstructure:\"nested\"`" + `
+	Nesteds []Nested ` + "`mapstructure:\"nesteds\"`" + `
+	Tags    []string ` + "`mapstructure:\"tags\"`" + `
+}
+`
+	if code := generateTestCode(t, src, Options{TypeNames: []string{"Config", "Nested"}}); bytes.Contains(code, []byte(`hcl:"`)) {
+		t.Fatalf("unexpected hcl tags in:\n%s", code)
+	}
+	code := generateTestCode(t, src, Options{TypeNames: []string{"Config", "Nested"}, EmitHCLTags: true})
+	for _, expected := range []string{
+		`cty:"name" hcl:"name,optional"`,
+		`cty:"nested" hcl:"nested,block"`,
+		`cty:"nesteds" hcl:"nesteds,block"`,
+		`cty:"tags" hcl:"tags,optional"`,
+		`cty:"value" hcl:"value,optional"`,
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+
+	out := runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go": `package main
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+func main() {
+	src := "name = \"a\"\nnested {\n  value = \"b\"\n}\nnesteds {\n  value = \"c\"\n}\nnesteds {\n  value = \"d\"\n}\n"
+	f, diags := hclsyntax.ParseConfig([]byte(src), "config.hcl", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		panic(diags)
+	}
+	var cfg FlatConfig
+	if diags := gohcl.DecodeBody(f.Body, nil, &cfg); diags.HasErrors() {
+		panic(diags)
+	}
+	fmt.Println(*cfg.Name, *cfg.Nested.Value, len(cfg.Nesteds), *cfg.Nesteds[1].Value)
+}
+`,
+	})
+	if expected := "a b 2 d\n"; out != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+}
+
+func TestOnlyChanged(t *testing.T) {
+	src := `package fixture
+
+type Config struct {
+	Name string ` + "`mapstructure:\"name\"`" + `
+}
+
+type Other struct {
+	Size int ` + "`mapstructure:\"size\"`" + `
+}
+`
+	manifest := Manifest{}
+	opts := Options{TypeNames: []string{"Config", "Other"}, OnlyChanged: true, Manifest: manifest}
+	code := generateTestCode(t, src, opts)
+	if len(manifest) != 2 {
+		t.Fatalf("expected the hashes of the 2 structs in the manifest, got %v", manifest)
+	}
+
+	// this comment is only kept if the FlatConfig code is reused.
+	kept := "// FlatConfig is an auto-generated flat version of Config.\n// kept\n"
+	previous := bytes.Replace(code, []byte("// FlatConfig is an auto-generated flat version of Config.\n"), []byte(kept), 1)
+	src = strings.Replace(src, "Size int", "Size string", 1)
+	opts.Previous = previous
+	code = generateTestCode(t, src, opts)
+
+	if !bytes.Contains(code, []byte(kept)) {
+		t.Fatalf("expected the unchanged FlatConfig code to be reused in:\n%s", code)
+	}
+	expected := `&hcldec.AttrSpec{Name: "size", Type: cty.String, Required: false}`
+	if !bytes.Contains(code, []byte(expected)) {
+		t.Fatalf("expected the changed FlatOther code to be regenerated with %s in:\n%s", expected, code)
+	}
+	if prev, cur := splitSections(previous)["FlatConfig"], splitSections(code)["FlatConfig"]; !bytes.Equal(prev, cur) {
+		t.Fatalf("expected FlatConfig to be byte-preserved, got:\n%s\nwas:\n%s", cur, prev)
+	}
+
+	// the code depends on the options too, ex: FlatMapstructure is only
+	// generated in the package of the original struct.
+	opts.PackageName = "other"
+	code = generateTestCode(t, src, opts)
+	if bytes.Contains(code, []byte(kept)) || bytes.Contains(code, []byte("FlatMapstructure")) {
+		t.Fatalf("expected FlatConfig to be regenerated with the new options in:\n%s", code)
+	}
+}
+
+func TestTrimPrefix(t *testing.T) {
+	src := `package main
+
+type AwsNested struct {
+	Value string ` + "`mapstructure:\"value\"`" + `
+}
+
+type AwsConfig struct {
+	Nested  AwsNested   ` + "`mapstructure:\"nested\"`" + `
+	Nesteds []AwsNested ` + "`mapstructure:\"nesteds\"`" + `
+}
+`
+	code := generateTestCode(t, src, Options{TypeNames: []string{"AwsConfig", "AwsNested"}, TrimPrefix: "Aws"})
+	for _, expected := range []string{
+		"type FlatConfig struct {",
+		"type FlatNested struct {",
+		"func (*AwsConfig) FlatMapstructure() interface{} { return new(FlatConfig) }",
+		"Nested  *FlatNested ",
+		"Nesteds []FlatNested ",
+		"hcldec.ObjectSpec((*FlatNested)(nil).HCL2Spec())",
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+
+	out := runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go": `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println(len((&FlatConfig{}).HCL2Spec()))
+}
+`,
+	})
+	if out != "2\n" {
+		t.Fatalf("expected a spec of 2 fields, got %q", out)
+	}
+}
+
+func TestGeneratorTagsOrder(t *testing.T) {
+	code := generateTestCode(t, `package main
+
+import "time"
+
+type Config struct {
+	Impedance complex128  `+"`mapstructure:\"impedance\"`"+`
+	Separator rune        `+"`mapstructure:\"separator\"`"+`
+	Expiry    time.Time   `+"`mapstructure:\"expiry\"`"+`
+	Stamps    []time.Time `+"`mapstructure:\"stamps\"`"+`
+	Data      []byte      `+"`mapstructure:\"data\"`"+`
+	Small     int8        `+"`mapstructure:\"small\"`"+`
+	Port      uint16      `+"`mapstructure:\"port\"`"+`
+}
+`, Options{KeepZeroValueDistinction: true})
+	for _, expected := range []string{
+		`cty:"impedance" hcl2encoding:"complex"`,
+		`cty:"separator" hcl2encoding:"rune"`,
+		`cty:"expiry" hcl2encoding:"rfc3339"`,
+		`cty:"stamps" hcl2encoding:"rfc3339"`,
+		`cty:"data" hcl2encoding:"base64"`,
+		`cty:"small" hcl2bounds:"-128,127"`,
+		`cty:"port" hcl2bounds:"0,65535"`,
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected the generator tags after the cty one, %s in:\n%s", expected, code)
+		}
+	}
+}
+
+func TestComplex(t *testing.T) {
+	flat, body := getTestSpecBody(t, `package fixture
+
+type Config struct {
+	Impedance complex128 `+"`mapstructure:\"impedance\"`"+`
+}
+`, "Config")
+
+	if got := flat.Field(0).Type().String(); got != "*string" {
+		t.Fatalf("expected the complex to be a *string, got %s", got)
+	}
+	if tag := flat.Tag(0); !strings.Contains(tag, `hcl2encoding:"complex"`) {
+		t.Fatalf("expected a complex encoding tag, got: %s", tag)
+	}
+	expected := `&hcldec.AttrSpec{Name:"impedance", Type:cty.String, Required:false}`
+	if !strings.Contains(body, expected) {
+		t.Fatalf("expected %s in spec:\n%s", expected, body)
+	}
+}
+
+func TestRune(t *testing.T) {
+	flat, body := getTestSpecBody(t, `package fixture
+
+type Char rune
+
+type Config struct {
+	Separator rune  `+"`mapstructure:\"separator\"`"+`
+	Quote     *Char `+"`mapstructure:\"quote\"`"+`
+	Offset    int32 `+"`mapstructure:\"offset\"`"+`
+}
+`, "Config")
+
+	for i, expected := range []string{"*string", "*string", "*int32"} {
+		if got := flat.Field(i).Type().String(); got != expected {
+			t.Fatalf("expected %s to be a %s, got %s", flat.Field(i).Name(), expected, got)
+		}
+		if tag := flat.Tag(i); strings.Contains(tag, `hcl2encoding:"rune"`) != (expected == "*string") {
+			t.Fatalf("unexpected encoding tag on %s: %s", flat.Field(i).Name(), tag)
+		}
+	}
+	for _, expected := range []string{
+		`&hcldec.AttrSpec{Name:"separator", Type:cty.String, Required:false}`,
+		`&hcldec.AttrSpec{Name:"quote", Type:cty.String, Required:false}`,
+		`&hcldec.AttrSpec{Name:"offset", Type:cty.Number, Required:false}`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("expected %s in spec:\n%s", expected, body)
+		}
+	}
+}
+
+// TestEncodedFieldsPrepare decodes HCL into a Flat struct and that into its
+// Config with config.Decode, like the Prepare of a builder does, to check
+// that the fields set in another form in HCL decode back into their Go
+// type.
+func TestEncodedFieldsPrepare(t *testing.T) {
+	src := `package main
+
+import "time"
+
+type Char rune
+
+type Config struct {
+	Separator rune  ` + "`mapstructure:\"separator\"`" + `
+	Quote     *Char ` + "`mapstructure:\"quote\"`" + `
+	Offset    int32 ` + "`mapstructure:\"offset\"`" + `
+
+	Impedance complex128 ` + "`mapstructure:\"impedance\"`" + `
+
+	Expiry time.Time   ` + "`mapstructure:\"expiry\"`" + `
+	Stamps []time.Time ` + "`mapstructure:\"stamps\"`" + `
+}
+`
+	main := `package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/packer/helper/config"
+)
+
+const src = ` + "`" + `
+separator = "é"
+quote     = "'"
+offset    = 42
+impedance = "(1+2i)"
+expiry    = "2006-01-02T15:04:05+07:00"
+stamps    = ["2006-01-02T15:04:05Z"]
+` + "`" + `
+
+func main() {
+	f, diags := hclsyntax.ParseConfig([]byte(src), "config.pkr.hcl", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		panic(diags)
+	}
+	v, diags := hcldec.Decode(f.Body, hcldec.ObjectSpec((*FlatConfig)(nil).HCL2Spec()), nil)
+	if diags.HasErrors() {
+		panic(diags)
+	}
+	var flat FlatConfig
+	if err := config.FromCtyValue(v, &flat); err != nil {
+		panic(err)
+	}
+	// the Prepare of a builder gets its config as a map through RPC.
+	b, err := json.Marshal(flat)
+	if err != nil {
+		panic(err)
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		panic(err)
+	}
+	var c Config
+	if err := config.Decode(&c, &config.DecodeOpts{}, raw); err != nil {
+		panic(err)
+	}
+	fmt.Println(string(c.Separator), string(*c.Quote), c.Offset, c.Impedance)
+	fmt.Println(c.Expiry.UTC(), c.Stamps)
+}
+`
+	code := generateTestCode(t, src, Options{})
+	out := runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go":            main,
+	})
+	expected := "é ' 42 (1+2i)\n2006-01-02 08:04:05 +0000 UTC [2006-01-02 15:04:05 +0000 UTC]\n"
+	if out != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+}
+
+func TestToSnakeCase(t *testing.T) {
+	for _, tc := range []struct{ in, out string }{
+		{"Name", "name"},
+		{"SSHPort", "ssh_port"},
+		{"HTTPPort", "http_port"},
+		{"AWSRegionID", "aws_region_id"},
+		{"OAuth2Token", "oauth2_token"},
+		{"IPv4Address", "ipv4_address"},
+		{"AssignIPv6", "assign_ipv6"},
+		{"MySQLHost", "mysql_host"},
+		{"PostgreSQLVersion", "postgresql_version"},
+		{"GraphQLEndpoint", "graphql_endpoint"},
+		{"VPCID", "vpcid"},
+		{"Win2012Image", "win2012_image"},
+		{"Boot_Command", "boot_command"},
+	} {
+		if got := ToSnakeCase(tc.in); got != tc.out {
+			t.Errorf("ToSnakeCase(%q) = %q, expected %q", tc.in, got, tc.out)
+		}
+	}
+}
+
+func TestToSnakeCase_extraInitialisms(t *testing.T) {
+	if got := ToSnakeCase("NetAppONTap"); got != "net_app_on_tap" {
+		t.Fatalf("unexpected %q", got)
+	}
+	defer func(initialisms []string) { MixedCaseInitialisms = initialisms }(MixedCaseInitialisms)
+	MixedCaseInitialisms = append(MixedCaseInitialisms, "NetApp", "ONTap")
+	if got := ToSnakeCase("NetAppONTap"); got != "netapp_ontap" {
+		t.Fatalf("unexpected %q", got)
+	}
+}
+
+func TestTimeTypes(t *testing.T) {
+	flat, body := getTestSpecBody(t, `package fixture
+
+import "time"
+
+type Config struct {
+	Timeout     time.Duration  `+"`mapstructure:\"timeout\"`"+`
+	MaxTimeout  *time.Duration `+"`mapstructure:\"max_timeout\"`"+`
+	NotBefore   time.Time      `+"`mapstructure:\"not_before\"`"+`
+	NotAfter    *time.Time     `+"`mapstructure:\"not_after\"`"+`
+}
+`, "Config")
+
+	for i := 0; i < flat.NumFields(); i++ {
+		if got := flat.Field(i).Type().String(); got != "*string" {
+			t.Fatalf("expected %s to be a *string, got %s", flat.Field(i).Name(), got)
+		}
+	}
+	for _, accessor := range []string{"timeout", "max_timeout", "not_before", "not_after"} {
+		expected := `&hcldec.AttrSpec{Name:"` + accessor + `", Type:cty.String, Required:false}`
+		if !strings.Contains(body, expected) {
+			t.Fatalf("expected %s in spec:\n%s", expected, body)
+		}
+	}
+}
+
+func TestTimeRFC3339(t *testing.T) {
+	flat, body := getTestSpecBody(t, `package fixture
+
+import "time"
+
+type Config struct {
+	Expiry time.Time   `+"`mapstructure:\"expiry\"`"+`
+	Stamps []time.Time `+"`mapstructure:\"stamps\"`"+`
+}
+`, "Config")
+
+	for i, expected := range []string{"*string", "[]string"} {
+		if got := flat.Field(i).Type().String(); got != expected {
+			t.Fatalf("expected %s to be a %s, got %s", flat.Field(i).Name(), expected, got)
+		}
+		if tag := flat.Tag(i); !strings.Contains(tag, `hcl2encoding:"rfc3339"`) {
+			t.Fatalf("expected a rfc3339 encoding on %s, got %s", flat.Field(i).Name(), tag)
+		}
+	}
+	for _, expected := range []string{
+		`&hcldec.AttrSpec{Name:"expiry", Type:cty.String, Required:false}`,
+		`&hcldec.AttrSpec{Name:"stamps", Type:cty.List(cty.String), Required:false}`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("expected %s in spec:\n%s", expected, body)
+		}
+	}
+}
+
+func TestTypeAliases(t *testing.T) {
+	flat, body := getTestSpecBody(t, `package fixture
+
+import "time"
+
+type MyDur = time.Duration
+
+type MyDurPtr = *time.Duration
+
+type Disk struct {
+	Size int `+"`mapstructure:\"size\"`"+`
+}
+
+type DiskAlias = Disk
+
+type Config struct {
+	Timeout    MyDur       `+"`mapstructure:\"timeout\"`"+`
+	MaxTimeout MyDurPtr    `+"`mapstructure:\"max_timeout\"`"+`
+	Disk       DiskAlias   `+"`mapstructure:\"disk\"`"+`
+	Disks      []DiskAlias `+"`mapstructure:\"disks\"`"+`
+}
+`, "Config")
+
+	for i, expected := range []string{"*string", "*string", "*fixture.FlatDisk", "[]fixture.FlatDisk"} {
+		if got := flat.Field(i).Type().String(); got != expected {
+			t.Fatalf("expected %s to be a %s, got %s", flat.Field(i).Name(), expected, got)
+		}
+	}
+	for _, accessor := range []string{"timeout", "max_timeout"} {
+		expected := `&hcldec.AttrSpec{Name:"` + accessor + `", Type:cty.String, Required:false}`
+		if !strings.Contains(body, expected) {
+			t.Fatalf("expected %s in spec:\n%s", expected, body)
+		}
+	}
+}
+
+func TestGenerate_all(t *testing.T) {
+	code, err := Generate(Options{
+		Patterns:     []string{"./testdata/all"},
+		All:          true,
+		ExcludeTypes: []string{"Internal"},
+	})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	for _, expected := range []string{"type FlatConfig struct", "type FlatNetwork struct"} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %q in:\n%s", expected, code)
+		}
+	}
+	// Plain has no mapstructure tag, hidden is unexported and FlatConfig is
+	// in a generated file.
+	for _, unexpected := range []string{"FlatInternal", "FlatPlain", "Flathidden", "FlatFlatConfig", "FlatMode"} {
+		if bytes.Contains(code, []byte(unexpected)) {
+			t.Fatalf("unexpected %q in:\n%s", unexpected, code)
+		}
+	}
+
+	_, err = Generate(Options{
+		Patterns:     []string{"./testdata/all"},
+		All:          true,
+		ExcludeTypes: []string{"Config", "Network", "Internal"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "no config-like type found") {
+		t.Fatalf("expected a no config-like type error, got %v", err)
+	}
+}
+
+func TestGenerate_implementing(t *testing.T) {
+	src := `package fixture
+
+type Configurer interface {
+	PackerConfig()
+}
+
+type BuilderConfig struct {
+	Name string ` + "`mapstructure:\"name\"`" + `
+}
+
+func (BuilderConfig) PackerConfig() {}
+
+type ProvisionerConfig struct {
+	Script string ` + "`mapstructure:\"script\"`" + `
+}
+
+func (*ProvisionerConfig) PackerConfig() {}
+
+type Other struct {
+	Value string ` + "`mapstructure:\"value\"`" + `
+}
+`
+	pkg := loadTestPackage(t, src)
+	code, err := generate(pkg, Options{Implementing: "Configurer"})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	for _, expected := range []string{"type FlatBuilderConfig struct", "type FlatProvisionerConfig struct"} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %q in:\n%s", expected, code)
+		}
+	}
+	if bytes.Contains(code, []byte("FlatOther")) {
+		t.Fatalf("unexpected FlatOther in:\n%s", code)
+	}
+
+	for ref, expected := range map[string]string{
+		"Missing": "marker interface Missing not found",
+		"Other":   "marker Other is not an interface",
+		"fmt.Foo": "package fmt is not imported",
+	} {
+		if _, err := generate(pkg, Options{Implementing: ref}); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected an error containing %q for %s, got %v", expected, ref, err)
+		}
+	}
+}
+
+func TestGenerate_tests(t *testing.T) {
+	opts := Options{Patterns: []string{"./testdata/tests"}, Tests: true, TypeNames: []string{"FixtureConfig"}, Strict: true}
+	pkgs, err := loadPackage(opts, packages.NeedName|packages.NeedFiles)
+	if err != nil {
+		t.Fatalf("loadPackage: %v", err)
+	}
+	// the external tests_test package is left out.
+	var files []string
+	for _, f := range pkgs[0].GoFiles {
+		files = append(files, filepath.Base(f))
+	}
+	if strings.Join(files, ",") != "config.go,config_test.go" {
+		t.Fatalf("expected the files of the tests package and its tests, got %v", files)
+	}
+
+	if _, isStd := types.SizesFor("gc", runtime.GOARCH).(*types.StdSizes); !isStd {
+		t.Skip("the vendored go/packages can't type check test mains with this Go version")
+	}
+	code, err := Generate(opts)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	for _, expected := range []string{"type FlatFixtureConfig struct", `"name":`, `"extra":`} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+	opts.Tests = false
+	if _, err := Generate(opts); err == nil {
+		t.Fatal("expected FixtureConfig not to be found without its _test.go file")
+	}
+}
+
+func TestGeneratePackages(t *testing.T) {
+	opts := Options{Patterns: []string{"./testdata/multi/..."}, All: true, IncludeNested: true}
+	serial, err := GeneratePackages(opts, 1)
+	if err != nil {
+		t.Fatalf("GeneratePackages: %v", err)
+	}
+	// c has no config-like type.
+	if len(serial) != 2 || !strings.HasSuffix(serial[0].PkgPath, "/multi/a") || !strings.HasSuffix(serial[1].PkgPath, "/multi/b") {
+		t.Fatalf("expected the code of a and b, got %+v", serial)
+	}
+	if filepath.Base(serial[0].Dir) != "a" || !bytes.Contains(serial[0].Code, []byte("type FlatDisk struct")) {
+		t.Fatalf("unexpected code for a in %s:\n%s", serial[0].Dir, serial[0].Code)
+	}
+
+	parallel, err := GeneratePackages(opts, 4)
+	if err != nil {
+		t.Fatalf("GeneratePackages: %v", err)
+	}
+	if len(parallel) != len(serial) {
+		t.Fatalf("expected %d packages, got %d", len(serial), len(parallel))
+	}
+	for i := range serial {
+		if parallel[i].PkgPath != serial[i].PkgPath || !bytes.Equal(parallel[i].Code, serial[i].Code) {
+			t.Fatalf("expected the same code for %s, got:\n%s\nand:\n%s", serial[i].PkgPath, serial[i].Code, parallel[i].Code)
+		}
+	}
+
+	logs := bytes.NewBuffer(nil)
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+	if _, err := GeneratePackages(Options{Patterns: opts.Patterns, TypeNames: []string{"Config", "Missing"}}, 4); err != nil {
+		t.Fatalf("GeneratePackages: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected a warning per package, got:\n%s", logs)
+	}
+	for i, name := range []string{"a", "b"} {
+		pkgPath := "github.com/hashicorp/packer/cmd/mapstructure-to-hcl2/generator/testdata/multi/" + name
+		if expected := pkgPath + ": warning: type(s) not found in " + pkgPath + ": Missing"; !strings.HasSuffix(lines[i], " "+expected) {
+			t.Fatalf("expected %q, got %q", expected, lines[i])
+		}
+	}
+}
+
+func TestLoadPackage(t *testing.T) {
+	load := Options{Patterns: []string{"./testdata/multi/a"}}
+	pkg, err := LoadPackage(load)
+	if err != nil {
+		t.Fatalf("LoadPackage: %v", err)
+	}
+	for _, opts := range []Options{
+		{TypeNames: []string{"Config"}},
+		{TypeNames: []string{"Disk"}, EmitHCLTags: true},
+		{All: true, IncludeNested: true},
+		{TypeNames: []string{"Config"}},
+	} {
+		cached, err := pkg.Generate(opts)
+		if err != nil {
+			t.Fatalf("Generate %+v: %v", opts, err)
+		}
+		opts.Patterns = load.Patterns
+		fresh, err := Generate(opts)
+		if err != nil {
+			t.Fatalf("Generate %+v: %v", opts, err)
+		}
+		if !bytes.Equal(cached, fresh) {
+			t.Fatalf("expected the same code for %v, got:\n%s\nand:\n%s", opts.TypeNames, cached, fresh)
+		}
+	}
+	if _, err := pkg.Generate(Options{}); err == nil {
+		t.Fatal("expected an error without type names")
+	}
+}
+
+func BenchmarkGenerate(b *testing.B) {
+	names := []string{"Config", "Disk"}
+	b.Run("fresh", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, name := range names {
+				if _, err := Generate(Options{Patterns: []string{"./testdata/multi/a"}, TypeNames: []string{name}}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			pkg, err := LoadPackage(Options{Patterns: []string{"./testdata/multi/a"}})
+			if err != nil {
+				b.Fatal(err)
+			}
+			for _, name := range names {
+				if _, err := pkg.Generate(Options{TypeNames: []string{name}}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
+
+func TestGenerate_packageName(t *testing.T) {
+	code, err := Generate(Options{
+		TypeNames:   []string{"Config", "Nested"},
+		Patterns:    []string{"./testdata/external"},
+		PackageName: "main",
+	})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	for _, expected := range []string{
+		"package main\n",
+		`"github.com/hashicorp/packer/cmd/mapstructure-to-hcl2/generator/testdata/external"`,
+		"Mode   *external.Mode ",
+		"Nested *FlatNested ",
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+	if bytes.Contains(code, []byte("FlatMapstructure")) {
+		t.Fatalf("unexpected FlatMapstructure method in another package:\n%s", code)
+	}
+
+	out := runGenerated(t, map[string]string{
+		"config.hcl2spec.go": string(code),
+		"main.go": `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println(len((&FlatConfig{}).HCL2Spec()))
+}
+`,
+	})
+	if out != "2\n" {
+		t.Fatalf("expected a spec of 2 fields, got %q", out)
+	}
+
+	if _, err := generate(loadTestPackage(t, "package fixture\n"), Options{TypeNames: []string{"Config"}, PackageName: "my-pkg"}); err == nil {
+		t.Fatal("expected an invalid package name error")
+	}
+}
+
+func TestCtyToFieldName(t *testing.T) {
+	src := `package main
+
+type Common struct {
+	SSHUser string ` + "`mapstructure:\"ssh_username\"`" + `
+}
+
+type Config struct {
+	Common   ` + "`mapstructure:\",squash\"`" + `
+	AMIName  string ` + "`mapstructure:\"ami_name\"`" + `
+	Untagged string
+}
+`
+	if code := generateTestCode(t, src, Options{}); bytes.Contains(code, []byte("CtyToFieldName")) {
+		t.Fatalf("expected no CtyToFieldName method by default in:\n%s", code)
+	}
+	code := generateTestCode(t, src, Options{CtyToFieldName: true})
+	if !bytes.Contains(code, []byte("func (*FlatConfig) CtyToFieldName() map[string]string {")) {
+		t.Fatalf("expected a CtyToFieldName method in:\n%s", code)
+	}
+
+	out := runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go": `package main
+
+import "fmt"
+
+func main() {
+	m := (&FlatConfig{}).CtyToFieldName()
+	fmt.Println(len(m), m["ssh_username"], m["ami_name"], m["untagged"])
+}
+`,
+	})
+	if expected := "3 SSHUser AMIName Untagged\n"; out != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+}
+
+func TestDuplicateAccessors(t *testing.T) {
+	src := `package fixture
+
+type A struct {
+	Foo string ` + "`mapstructure:\"foo\"`" + `
+}
+
+type B struct {
+	Bar string ` + "`mapstructure:\"foo\"`" + `
+}
+
+type Config struct {
+	A ` + "`mapstructure:\",squash\"`" + `
+	B ` + "`mapstructure:\",squash\"`" + `
+}
+`
+	code := generateTestCode(t, src, Options{})
+	if !bytes.Contains(code, []byte("Foo *string")) || bytes.Contains(code, []byte("Bar *string")) {
+		t.Fatalf("expected the second foo field to be dropped in:\n%s", code)
+	}
+
+	_, err := generate(loadTestPackage(t, src), Options{TypeNames: []string{"Config"}, Strict: true})
+	if err == nil {
+		t.Fatal("expected a duplicate cty name error")
+	}
+	for _, expected := range []string{"duplicate", `"foo"`, "A.Foo (*string)", "B.Bar (*string)"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected %s in error: %v", expected, err)
+		}
+	}
+}
+
+func TestRequiredFields(t *testing.T) {
+	src := `package main
+
+type Disk struct {
+	Size int ` + "`mapstructure:\"size\"`" + `
+}
+
+type Config struct {
+	Name   string   ` + "`mapstructure:\"name\"`" + `
+	Port   *int     ` + "`mapstructure:\"port\"`" + `
+	Region string   ` + "`mapstructure:\"region\"`" + `
+	Tags   []string ` + "`mapstructure:\"tags\"`" + `
+	Disk   Disk     ` + "`mapstructure:\"disk\"`" + `
+}
+`
+	code := generateTestCode(t, src, Options{TypeNames: []string{"Config", "Disk"}, RequiredFields: []string{"name", "port", "size"}})
+	for _, expected := range []string{
+		"Name   string ",
+		"Port   int ",
+		"Region *string ",
+		"Size int ",
+		`"name":   &hcldec.AttrSpec{Name: "name", Type: cty.String, Required: true}`,
+		`"port":   &hcldec.AttrSpec{Name: "port", Type: cty.Number, Required: true}`,
+		`"region": &hcldec.AttrSpec{Name: "region", Type: cty.String, Required: false}`,
+		`"size": &hcldec.AttrSpec{Name: "size", Type: cty.Number, Required: true}`,
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+}
+
+func TestNoPointerBasics(t *testing.T) {
+	src := `package main
+
+import "time"
+
+type Mode string
+
+type Config struct {
+	Name    string        ` + "`mapstructure:\"name\"`" + `
+	Mode    Mode          ` + "`mapstructure:\"mode\"`" + `
+	Port    *int          ` + "`mapstructure:\"port\"`" + `
+	Timeout time.Duration ` + "`mapstructure:\"timeout\"`" + `
+}
+`
+	for _, tc := range []struct {
+		opts     Options
+		expected []string
+	}{
+		{Options{}, []string{
+			"Name    *string ",
+			"Mode    *Mode ",
+			"Port    *int ",
+			`"name":    &hcldec.AttrSpec{Name: "name", Type: cty.String, Required: false}`,
+			`"mode":    &hcldec.AttrSpec{Name: "mode", Type: cty.String, Required: false}`,
+			`"port":    &hcldec.AttrSpec{Name: "port", Type: cty.Number, Required: false}`,
+		}},
+		{Options{NoPointerBasics: true}, []string{
+			"Name    string ",
+			"Mode    Mode ",
+			"Port    int ",
+			"Timeout *string ",
+			`"name":    &hcldec.AttrSpec{Name: "name", Type: cty.String, Required: true}`,
+			`"mode":    &hcldec.AttrSpec{Name: "mode", Type: cty.String, Required: true}`,
+			`"port":    &hcldec.AttrSpec{Name: "port", Type: cty.Number, Required: true}`,
+			`"timeout": &hcldec.AttrSpec{Name: "timeout", Type: cty.String, Required: false}`,
+		}},
+	} {
+		code := generateTestCode(t, src, tc.opts)
+		for _, expected := range tc.expected {
+			if !bytes.Contains(code, []byte(expected)) {
+				t.Fatalf("expected %s with %+v in:\n%s", expected, tc.opts, code)
+			}
+		}
+	}
+
+	code := generateTestCode(t, src, Options{NoPointerBasics: true})
+	out := runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go": `package main
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty/gocty"
+)
+
+func main() {
+	for _, src := range []string{"name = \"a\"\nmode = \"b\"\nport = 22\n", "name = \"a\"\n"} {
+		f, diags := hclsyntax.ParseConfig([]byte(src), "config.hcl", hcl.Pos{Line: 1, Column: 1})
+		if diags.HasErrors() {
+			panic(diags)
+		}
+		val, diags := hcldec.Decode(f.Body, hcldec.ObjectSpec((&FlatConfig{}).HCL2Spec()), nil)
+		if diags.HasErrors() {
+			fmt.Println("missing")
+			continue
+		}
+		var c FlatConfig
+		if err := gocty.FromCtyValue(val, &c); err != nil {
+			panic(err)
+		}
+		fmt.Println(c.Name, c.Mode, c.Port, c.Timeout == nil)
+	}
+}
+`,
+	})
+	if out != "a b 22 true\nmissing\n" {
+		t.Fatalf("unexpected output: %s", out)
+	}
+}
+
+func TestTypeOverride(t *testing.T) {
+	src := `package main
+
+type Wrapper struct{ Value string }
+
+type Config struct {
+	Name    Wrapper   ` + "`mapstructure:\"name\" hcl2type:\"string\"`" + `
+	Size    Wrapper   ` + "`mapstructure:\"size\" hcl2type:\"number\"`" + `
+	Enabled Wrapper   ` + "`mapstructure:\"enabled\" hcl2type:\"bool\"`" + `
+	Zones   []Wrapper ` + "`mapstructure:\"zones\" hcl2type:\"list(string)\"`" + `
+}
+`
+	code := generateTestCode(t, src, Options{})
+	for _, expected := range []string{
+		"Name    *string ",
+		"Size    *float64 ",
+		"Enabled *bool ",
+		"Zones   []string ",
+		`"name":    &hcldec.AttrSpec{Name: "name", Type: cty.String, Required: false}`,
+		`"size":    &hcldec.AttrSpec{Name: "size", Type: cty.Number, Required: false}`,
+		`"enabled": &hcldec.AttrSpec{Name: "enabled", Type: cty.Bool, Required: false}`,
+		`"zones":   &hcldec.AttrSpec{Name: "zones", Type: cty.List(cty.String), Required: false}`,
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+	if bytes.Contains(code, []byte("FlatWrapper")) {
+		t.Fatalf("unexpected FlatWrapper in:\n%s", code)
+	}
+
+	out := runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go": `package main
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty/gocty"
+)
+
+func main() {
+	src := "name = \"a\"\nsize = 1.5\nenabled = true\nzones = [\"b\", \"c\"]\n"
+	f, diags := hclsyntax.ParseConfig([]byte(src), "config.hcl", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		panic(diags)
+	}
+	val, diags := hcldec.Decode(f.Body, hcldec.ObjectSpec((&FlatConfig{}).HCL2Spec()), nil)
+	if diags.HasErrors() {
+		panic(diags)
+	}
+	var c FlatConfig
+	if err := gocty.FromCtyValue(val, &c); err != nil {
+		panic(err)
+	}
+	fmt.Println(*c.Name, *c.Size, *c.Enabled, c.Zones)
+}
+`,
+	})
+	if out != "a 1.5 true [b c]\n" {
+		t.Fatalf("unexpected output: %s", out)
+	}
+
+	_, err := generate(loadTestPackage(t, `package main
+
+type Config struct {
+	Name string `+"`mapstructure:\"name\" hcl2type:\"map(string)\"`"+`
+}
+`), Options{TypeNames: []string{"Config"}})
+	if err == nil || !strings.Contains(err.Error(), `unsupported hcl2type "map(string)"`) {
+		t.Fatalf("expected an unsupported hcl2type error, got %v", err)
+	}
+}
+
+func TestIncludeUnexported(t *testing.T) {
+	src := `package main
+
+type inner struct {
+	Name string ` + "`mapstructure:\"name\"`" + `
+}
+
+type config struct {
+	Inner  inner  ` + "`mapstructure:\"inner\"`" + `
+	Region string ` + "`mapstructure:\"region\"`" + `
+	secret string
+}
+`
+	code := generateTestCode(t, src, Options{TypeNames: []string{"config"}})
+	if !bytes.Contains(code, []byte("type Flatconfig struct {")) {
+		t.Fatalf("expected the Flatconfig name without IncludeUnexported in:\n%s", code)
+	}
+
+	code = generateTestCode(t, src, Options{TypeNames: []string{"config", "inner"}, IncludeUnexported: true})
+	for _, expected := range []string{
+		"type FlatConfig struct {",
+		"type FlatInner struct {",
+		"Inner  *FlatInner ",
+		"func (*config) FlatMapstructure() interface{}",
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+	if bytes.Contains(code, []byte("secret")) {
+		t.Fatalf("unexpected unexported field in:\n%s", code)
+	}
+
+	runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go":            "package main\n\nfunc main() { _ = (&config{}).FlatMapstructure().(*FlatConfig).HCL2Spec() }\n",
+	})
+}
+
+func TestEmitStringer(t *testing.T) {
+	src := `package main
+
+type Disk struct {
+	Size int ` + "`mapstructure:\"size\"`" + `
+}
+
+type Config struct {
+	Name    string            ` + "`mapstructure:\"name\"`" + `
+	Port    int               ` + "`mapstructure:\"port\"`" + `
+	Root    Disk              ` + "`mapstructure:\"root\"`" + `
+	Disks   []Disk            ` + "`mapstructure:\"disks\"`" + `
+	Zones   []string          ` + "`mapstructure:\"zones\"`" + `
+	Tags    map[string]string ` + "`mapstructure:\"tags\"`" + `
+	Enabled *bool             ` + "`mapstructure:\"enabled\"`" + `
+}
+`
+	code := generateTestCode(t, src, Options{TypeNames: []string{"Config", "Disk"}, EmitStringer: true})
+	if !bytes.Contains(code, []byte("func (c *FlatConfig) String() string {")) {
+		t.Fatalf("expected a String method in:\n%s", code)
+	}
+
+	out := runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go": `package main
+
+import "fmt"
+
+func main() {
+	name, size, other := "a", 10, 20
+	c := &FlatConfig{
+		Name:  &name,
+		Root:  &FlatDisk{Size: &size},
+		Disks: []FlatDisk{{Size: &other}, {}},
+		Zones: []string{"b", "c"},
+	}
+	fmt.Println(c)
+	fmt.Println((*FlatConfig)(nil))
+}
+`,
+	})
+	expected := `FlatConfig{Name: "a", Port: nil, Root: FlatDisk{Size: 10}, Disks: [FlatDisk{Size: 20}, FlatDisk{Size: nil}], Zones: ["b" "c"], Tags: nil, Enabled: nil}` + "\nnil\n"
+	if out != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+
+	code = generateTestCode(t, src, Options{TypeNames: []string{"Config", "Disk"}})
+	if bytes.Contains(code, []byte("String()")) || bytes.Contains(code, []byte(`"strings"`)) {
+		t.Fatalf("unexpected String method without EmitStringer in:\n%s", code)
+	}
+}
+
+func TestHeader(t *testing.T) {
+	src := `package fixture
+
+type Config struct {
+	Name string ` + "`mapstructure:\"name\"`" + `
+}
+`
+	header := "SPDX-License-Identifier: MPL-2.0\n\n// Copyright (c) Example\n"
+	marker := regexp.MustCompile(`(?m)^// Code generated .* DO NOT EDIT\.$`)
+	for _, before := range []bool{false, true} {
+		code := generateTestCode(t, src, Options{Header: header, HeaderBeforeMarker: before})
+		expected := "// SPDX-License-Identifier: MPL-2.0\n//\n// Copyright (c) Example\n"
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected the header %q in:\n%s", expected, code)
+		}
+		headerAt := bytes.Index(code, []byte(expected))
+		loc := marker.FindIndex(code)
+		if loc == nil {
+			t.Fatalf("expected the code generated marker in:\n%s", code)
+		}
+		if before != (headerAt < loc[0]) {
+			t.Fatalf("expected the header before the marker: %t, in:\n%s", before, code)
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), "config.hcl2spec.go", code, parser.ParseComments)
+		if err != nil {
+			t.Fatalf("%v in:\n%s", err, code)
+		}
+		if loc[0] > int(f.Package) {
+			t.Fatalf("expected the marker before the package clause in:\n%s", code)
+		}
+		if f.Doc != nil && strings.Contains(f.Doc.Text(), "SPDX") {
+			t.Fatalf("unexpected header in the package doc:\n%s", code)
+		}
+	}
+}
+
+func TestIncludeNested(t *testing.T) {
+	src := `package main
+
+type Inner struct {
+	Value string ` + "`mapstructure:\"value\"`" + `
+}
+
+type Nested struct {
+	Inner Inner ` + "`mapstructure:\"inner\"`" + `
+}
+
+type Disk struct {
+	Size int ` + "`mapstructure:\"size\"`" + `
+}
+
+type Unused struct {
+	Name string ` + "`mapstructure:\"name\"`" + `
+}
+
+type Config struct {
+	Nested Nested ` + "`mapstructure:\"nested\"`" + `
+	Disks  []Disk ` + "`mapstructure:\"disks\"`" + `
+}
+`
+	code := generateTestCode(t, src, Options{})
+	if bytes.Contains(code, []byte("type FlatNested struct")) {
+		t.Fatalf("unexpected FlatNested without IncludeNested in:\n%s", code)
+	}
+
+	code = generateTestCode(t, src, Options{IncludeNested: true})
+	for _, expected := range []string{
+		"type FlatConfig struct",
+		"type FlatNested struct",
+		"type FlatInner struct",
+		"type FlatDisk struct",
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+	if bytes.Contains(code, []byte("FlatUnused")) {
+		t.Fatalf("unexpected FlatUnused in:\n%s", code)
+	}
+
+	runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go":            "package main\n\nfunc main() { _ = (&FlatConfig{}).HCL2Spec() }\n",
+	})
+}
+
+func TestBigNumbers(t *testing.T) {
+	src := `package main
+
+import "math/big"
+
+type Config struct {
+	Count *big.Int  ` + "`mapstructure:\"count\"`" + `
+	Ratio big.Float ` + "`mapstructure:\"ratio\"`" + `
+}
+`
+	code := generateTestCode(t, src, Options{ToCtyValue: true})
+	for _, expected := range []string{
+		"Count *big.Int ",
+		"Ratio *big.Float ",
+		`"count": &hcldec.AttrSpec{Name: "count", Type: cty.Number, Required: false}`,
+		`"ratio": &hcldec.AttrSpec{Name: "ratio", Type: cty.Number, Required: false}`,
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+
+	out := runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go": `package main
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty/gocty"
+)
+
+func main() {
+	src := "count = 123456789012345678901234567890\nratio = 0.1234567890123456789\n"
+	f, diags := hclsyntax.ParseConfig([]byte(src), "config.hcl", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		panic(diags)
+	}
+	val, diags := hcldec.Decode(f.Body, hcldec.ObjectSpec((&FlatConfig{}).HCL2Spec()), nil)
+	if diags.HasErrors() {
+		panic(diags)
+	}
+	var c FlatConfig
+	if err := gocty.FromCtyValue(val, &c); err != nil {
+		panic(err)
+	}
+	fmt.Println(c.Count, c.Ratio.Text('f', 19))
+	back, err := c.ToCtyValue()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(back.GetAttr("count").AsBigFloat().Text('f', 0))
+}
+`,
+	})
+	expected := "123456789012345678901234567890 0.1234567890123456789\n123456789012345678901234567890\n"
+	if out != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+}
+
+func TestFieldTransformers(t *testing.T) {
+	src := `package main
+
+type Secret struct{ value string }
+
+type Common struct {
+	Internal string ` + "`mapstructure:\"internal\"`" + `
+}
+
+type Config struct {
+	Common   ` + "`mapstructure:\",squash\"`" + `
+	Password Secret ` + "`mapstructure:\"password\"`" + `
+	Name     string ` + "`mapstructure:\"name\"`" + `
+}
+`
+	var seen []string
+	opts := Options{FieldTransformers: []FieldTransformer{
+		func(field *types.Var, tag string) (*types.Var, string, bool) {
+			seen = append(seen, field.Name())
+			return field, tag, field.Name() != "Internal"
+		},
+		func(field *types.Var, tag string) (*types.Var, string, bool) {
+			if named, isNamed := field.Type().(*types.Named); isNamed && named.Obj().Name() == "Secret" {
+				field = types.NewField(field.Pos(), field.Pkg(), field.Name(), types.Typ[types.String], field.Embedded())
+				tag += ` sensitive:"true"`
+			}
+			return field, tag, true
+		},
+	}}
+	code := generateTestCode(t, src, opts)
+	for _, expected := range []string{
+		"Password *string `mapstructure:\"password\" sensitive:\"true\" cty:\"password\"`",
+		`"password": &hcldec.AttrSpec{Name: "password", Type: cty.String, Required: false}`,
+		`"name":     &hcldec.AttrSpec{Name: "name", Type: cty.String, Required: false}`,
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+	if bytes.Contains(code, []byte("internal")) || bytes.Contains(code, []byte("FlatSecret")) {
+		t.Fatalf("unexpected transformed fields in:\n%s", code)
+	}
+	if got := strings.Join(seen, ","); got != "Common,Internal,Password,Name" {
+		t.Fatalf("expected the transformers to see each field, squashed ones included, got %s", got)
+	}
+}
+
+func TestSquashInterface(t *testing.T) {
+	logs := bytes.NewBuffer(nil)
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	flat, _ := getTestSpecBody(t, `package fixture
+
+type Provider interface {
+	Name() string
+}
+
+// Go doesn't allow embedding a pointer to an interface, it can only be
+// squashed as a named field.
+type Config struct {
+	Provider `+"`mapstructure:\",squash\"`"+`
+	Fallback *Provider `+"`mapstructure:\",squash\"`"+`
+	Region   string    `+"`mapstructure:\"region\"`"+`
+}
+`, "Config")
+	if flat.NumFields() != 1 || flat.Field(0).Name() != "Region" {
+		t.Fatalf("expected only the Region field, got %s", flat)
+	}
+	for _, expected := range []string{
+		"skipping field Config.Provider: squash is only supported on structs, fixture.Provider is not one",
+		"skipping field Config.Fallback: squash is only supported on structs, *fixture.Provider is not one",
+	} {
+		if !strings.Contains(logs.String(), expected) {
+			t.Fatalf("expected %q in the logs, got: %q", expected, logs.String())
+		}
+	}
+}
+
+func TestLogPositions(t *testing.T) {
+	logs := bytes.NewBuffer(nil)
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	generateTestCode(t, `package fixture
+
+type Provider interface {
+	Name() string
+}
+
+type Config struct {
+	Provider `+"`mapstructure:\",squash\"`"+`
+	Name     string `+"`mapstructure:\"name,min=1\"`"+`
+}
+`, Options{})
+	for _, expected := range []string{
+		"fixture.go:8: skipping field Config.Provider: squash is only supported on structs",
+		"fixture.go:9: ignoring min/max of non numeric field FlatConfig.Name",
+	} {
+		if !strings.Contains(logs.String(), expected) {
+			t.Fatalf("expected %q in the logs, got: %q", expected, logs.String())
+		}
+	}
+}
+
+func TestMalformedTags(t *testing.T) {
+	logs := bytes.NewBuffer(nil)
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	code := string(generateTestCode(t, `package fixture
+
+type Config struct {
+	Name   string `+"`mapstructure:'name'`"+`
+	Region string `+"` mapstructure:\"region\"  `"+`
+}
+`, Options{}))
+	expected := "fixture.go:4: field Config.Name: ignoring its malformed tag `mapstructure:'name'`"
+	if !strings.Contains(logs.String(), expected) {
+		t.Fatalf("expected %q in the logs, got: %q", expected, logs.String())
+	}
+	for _, expected := range []string{
+		// named like mapstructure names an untagged field.
+		"Name   *string `cty:\"name\"`",
+		"Region *string `mapstructure:\"region\" cty:\"region\"`",
+	} {
+		if !strings.Contains(code, expected) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+}
+
+func TestSortedSpecBody(t *testing.T) {
+	fields := []string{
+		"Zone string `mapstructure:\"zone\"`",
+		"Tags map[string]string `mapstructure:\"tags\"`",
+		"Name string `mapstructure:\"name\"`",
+		"Ports []int `mapstructure:\"ports\"`",
+		"Accept bool `mapstructure:\"accept\"`",
+	}
+	src := func(fields []string) string {
+		return "package fixture\n\ntype Config struct {\n\t" + strings.Join(fields, "\n\t") + "\n}\n"
+	}
+	_, body := getTestSpecBody(t, src(fields), "Config")
+	shuffled := []string{fields[3], fields[0], fields[4], fields[2], fields[1]}
+	_, shuffledBody := getTestSpecBody(t, src(shuffled), "Config")
+	if body != shuffledBody {
+		t.Fatalf("expected the same spec body whatever the order of the fields, got:\n%s\nand:\n%s", body, shuffledBody)
+	}
+	var names []string
+	for _, line := range strings.Split(body, "\n") {
+		if i := strings.Index(line, "\":"); i > 0 {
+			names = append(names, strings.TrimLeft(line[:i], "\t\""))
+		}
+	}
+	if got := strings.Join(names, ","); got != "accept,name,ports,tags,zone" {
+		t.Fatalf("expected the entries to be sorted, got %s in:\n%s", got, body)
+	}
+}
+
+func TestKeepZeroValueDistinction(t *testing.T) {
+	src := `package main
+
+type Nested struct {
+	Size int ` + "`mapstructure:\"size\"`" + `
+}
+
+type Config struct {
+	Port    int      ` + "`mapstructure:\"port\"`" + `
+	Name    string   ` + "`mapstructure:\"name\"`" + `
+	Debug   bool     ` + "`mapstructure:\"debug\"`" + `
+	Level   uint8    ` + "`mapstructure:\"level\"`" + `
+	Ratio   float64  ` + "`mapstructure:\"ratio\"`" + `
+	Retries int      ` + "`mapstructure:\"retries,min=1\" default:\"3\"`" + `
+	Nested  Nested   ` + "`mapstructure:\"nested\"`" + `
+	Items   []Nested ` + "`mapstructure:\"items\"`" + `
+	Tags    []string ` + "`mapstructure:\"tags\"`" + `
+}
+`
+	opts := Options{TypeNames: []string{"Config", "Nested"}, KeepZeroValueDistinction: true, ToCtyValue: true}
+	code := generateTestCode(t, src, opts)
+	for _, expected := range []string{
+		`Port\s+config\.NullableInt\s`,
+		`Level\s+config\.NullableUint\s.*hcl2bounds:"0,255"`,
+		`Nested\s+\*FlatNested\s`,
+		`"port":\s+&hcldec\.AttrSpec\{Name: "port", Type: cty\.Number, Required: false\}`,
+		`func \(c \*FlatNested\) FromCtyValue\(val cty\.Value\) error \{`,
+		`if c\.Retries\.IsSet && \(c\.Retries\.Value < 1\) \{`,
+	} {
+		if !regexp.MustCompile(expected).Match(code) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+
+	out := runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go": `package main
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+func main() {
+	f, diags := hclsyntax.ParseConfig([]byte(` + "`" + `
+port = 0
+name = ""
+nested {
+  size = 0
+}
+items {
+}
+items {
+  size = 3
+}
+` + "`" + `), "config.pkr.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		panic(diags)
+	}
+	c := &FlatConfig{}
+	val, diags := hcldec.Decode(f.Body, hcldec.ObjectSpec(c.HCL2Spec()), nil)
+	if diags.HasErrors() {
+		panic(diags)
+	}
+	if err := c.FromCtyValue(val); err != nil {
+		panic(err)
+	}
+	fmt.Println(c.Port.IsSet, c.Name.IsSet, c.Debug.IsSet, c.Nested.Size.IsSet, c.Items[0].Size.IsSet, c.Items[1].Size, c.Tags == nil)
+
+	v, err := c.ToCtyValue()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(v.GetAttr("port").IsNull(), v.GetAttr("debug").IsNull(), v.GetAttr("nested").GetAttr("size").IsNull())
+	back := &FlatConfig{}
+	if err := back.FromCtyValue(v); err != nil {
+		panic(err)
+	}
+	fmt.Println(reflect.DeepEqual(c, back))
+
+	c.ApplyDefaults()
+	fmt.Println(c.Retries, c.Port, len(c.Validate()))
+}
+`,
+	})
+	expected := "true true false true false 3 true\nfalse true false\ntrue\n3 0 0\n"
+	if out != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+}
+
+func TestEmptyStructBlocks(t *testing.T) {
+	src := `package main
+
+type Toggle struct{}
+
+type Hidden struct {
+	internal int
+}
+
+type Config struct {
+	Enabled struct{} ` + "`mapstructure:\"enabled\"`" + `
+	Toggle  Toggle   ` + "`mapstructure:\"toggle\"`" + `
+	Hidden  Hidden   ` + "`mapstructure:\"hidden\"`" + `
+	Unset   Toggle   ` + "`mapstructure:\"unset\"`" + `
+}
+`
+	typeNames := []string{"Config", "Toggle", "Hidden"}
+	code := generateTestCode(t, src, Options{TypeNames: typeNames})
+	for _, expected := range []string{
+		`"enabled": &hcldec.BlockSpec{TypeName: "enabled", Nested: hcldec.ObjectSpec((*FlatConfigEnabled)(nil).HCL2Spec())}`,
+		`"toggle":  &hcldec.BlockSpec{TypeName: "toggle", Nested: hcldec.ObjectSpec((*FlatToggle)(nil).HCL2Spec())}`,
+		`"hidden":  &hcldec.BlockSpec{TypeName: "hidden", Nested: hcldec.ObjectSpec((*FlatHidden)(nil).HCL2Spec())}`,
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+
+	main := `package main
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/gocty"
+)
+
+func main() {
+	f, diags := hclsyntax.ParseConfig([]byte("enabled {}\ntoggle {}\nhidden {}\n"), "config.pkr.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		panic(diags)
+	}
+	c := &FlatConfig{}
+	val, diags := hcldec.Decode(f.Body, hcldec.ObjectSpec(c.HCL2Spec()), nil)
+	if diags.HasErrors() {
+		panic(diags)
+	}
+	var err error
+	if cd, ok := interface{}(c).(interface{ FromCtyValue(cty.Value) error }); ok {
+		err = cd.FromCtyValue(val)
+	} else {
+		err = gocty.FromCtyValue(val, c)
+	}
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(c.Enabled != nil, c.Toggle != nil, c.Hidden != nil, c.Unset != nil)
+	v, err := c.ToCtyValue()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(v.GetAttr("toggle").IsNull(), v.GetAttr("unset").IsNull())
+}
+`
+	for _, opts := range []Options{
+		{TypeNames: typeNames, ToCtyValue: true},
+		{TypeNames: typeNames, ToCtyValue: true, EmitStringer: true},
+		{TypeNames: typeNames, ToCtyValue: true, KeepZeroValueDistinction: true},
+	} {
+		out := runGenerated(t, map[string]string{
+			"config.go":          src,
+			"config.hcl2spec.go": string(generateTestCode(t, src, opts)),
+			"main.go":            main,
+		})
+		if expected := "true true true false\nfalse true\n"; out != expected {
+			t.Fatalf("%+v: expected:\n%s\ngot:\n%s", opts, expected, out)
+		}
+	}
+}
+
+func TestFlatNameCollision(t *testing.T) {
+	src := `package fixture
+
+type Nested struct {
+	Name string ` + "`mapstructure:\"name\"`" + `
+}
+
+type Config struct {
+	Nested Nested ` + "`mapstructure:\"nested\"`" + `
+}
+
+type FlatNested struct{}
+`
+	_, err := generate(loadTestPackage(t, src), Options{TypeNames: []string{"Config", "Nested"}})
+	if err == nil || !strings.Contains(err.Error(), "fixture.go:11: FlatNested is already declared") {
+		t.Fatalf("expected a redeclaration error, got %v", err)
+	}
+
+	// only the Flat struct of Config is generated, it refers to the
+	// hand-written FlatNested.
+	code := generateTestCode(t, src, Options{})
+	if bytes.Contains(code, []byte("type FlatNested struct")) {
+		t.Fatalf("expected no FlatNested in:\n%s", code)
+	}
+
+	// the Flat structs of a previous generation are replaced.
+	generated := "// Code generated by \"mapstructure-to-hcl2 -type Config,Nested\"; DO NOT EDIT.\n\n" + src
+	code = generateTestCode(t, generated, Options{TypeNames: []string{"Config", "Nested"}})
+	if !bytes.Contains(code, []byte("type FlatNested struct")) {
+		t.Fatalf("expected a FlatNested struct in:\n%s", code)
+	}
+}
+
+func TestGenericConfig(t *testing.T) {
+	src := `package fixture
+
+type Config[T any] struct {
+	Value T      ` + "`mapstructure:\"value\"`" + `
+	Name  string ` + "`mapstructure:\"name\"`" + `
+}
+
+type StringConfig Config[string]
+`
+	_, err := generate(loadTestPackage(t, src), Options{TypeNames: []string{"Config"}})
+	if err == nil || !strings.Contains(err.Error(), "fixture.go:3: Config has type parameters and can't be flattened") {
+		t.Fatalf("expected a type parameters error, got %v", err)
+	}
+
+	// an instantiation is a struct like any other, -all only finds it.
+	for _, opts := range []Options{{TypeNames: []string{"StringConfig"}}, {All: true}} {
+		code, err := generate(loadTestPackage(t, src), opts)
+		if err != nil {
+			t.Fatalf("%+v: %v", opts, err)
+		}
+		for _, expected := range []string{"type FlatStringConfig struct", "Value *string "} {
+			if !bytes.Contains(code, []byte(expected)) {
+				t.Fatalf("%+v: expected %q in:\n%s", opts, expected, code)
+			}
+		}
+		if bytes.Contains(code, []byte("type FlatConfig ")) {
+			t.Fatalf("%+v: unexpected FlatConfig in:\n%s", opts, code)
+		}
+	}
+}
+
+func TestFieldRenames(t *testing.T) {
+	src := `package fixture
+
+type A struct {
+	Foo string ` + "`mapstructure:\"foo\"`" + `
+}
+
+type B struct {
+	Bar string ` + "`mapstructure:\"foo\"`" + `
+}
+
+type Config struct {
+	A ` + "`mapstructure:\",squash\"`" + `
+	B ` + "`mapstructure:\",squash\"`" + `
+}
+`
+	code := generateTestCode(t, src, Options{
+		Strict:       true,
+		FieldRenames: map[string]string{"B.Bar": "bar"},
+	})
+	for _, expected := range []string{
+		`Foo *string ` + "`mapstructure:\"foo\" cty:\"foo\"`",
+		`Bar *string ` + "`mapstructure:\"foo\" cty:\"bar\"`",
+		`"foo": &hcldec.AttrSpec{Name: "foo", Type: cty.String, Required: false},`,
+		`"bar": &hcldec.AttrSpec{Name: "bar", Type: cty.String, Required: false},`,
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+}
+
+func TestIgnoreFields(t *testing.T) {
+	src := `package fixture
+
+type Common struct {
+	Unused []string
+	Region string ` + "`mapstructure:\"region\"`" + `
+}
+
+type Config struct {
+	Common ` + "`mapstructure:\",squash\"`" + `
+	Keys   []string ` + "`mapstructure:\"keys\"`" + `
+	Name   string   ` + "`mapstructure:\"name\"`" + `
+}
+`
+	pkg, str := getTestStruct(t, src, "Config")
+	flat, _, err := getMapstructureSquashedStruct(pkg, str, Options{IgnoreFields: []string{"Keys", "Unused"}}, "Config", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for i := 0; i < flat.NumFields(); i++ {
+		names = append(names, flat.Field(i).Name())
+	}
+	if got := strings.Join(names, ","); got != "Region,Name" {
+		t.Fatalf("expected the Region and Name fields only, got %s", got)
+	}
+}
+
+func TestImportAliases_squashed(t *testing.T) {
+	src := `package main
+
+import (
+	"github.com/hashicorp/packer/cmd/mapstructure-to-hcl2/generator/testdata/imports/a/config"
+	bconfig "github.com/hashicorp/packer/cmd/mapstructure-to-hcl2/generator/testdata/imports/b/config"
+)
+
+type Config struct {
+	A config.Common  ` + "`mapstructure:\",squash\"`" + `
+	B bconfig.Common ` + "`mapstructure:\",squash\"`" + `
+}
+`
+	code := generateTestCode(t, src, Options{})
+	for _, expected := range []string{
+		`	"github.com/hashicorp/packer/cmd/mapstructure-to-hcl2/generator/testdata/imports/a/config"`,
+		`	config2 "github.com/hashicorp/packer/cmd/mapstructure-to-hcl2/generator/testdata/imports/b/config"`,
+		"Settings config.Settings ",
+		"Extra    map[string]config2.Settings ",
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+
+	runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go":            "package main\n\nfunc main() { _ = FlatConfig{} }\n",
+	})
+}
+
+func TestDescription(t *testing.T) {
+	src := `package fixture
+
+type Disk struct {
+	Size int ` + "`mapstructure:\"size\"`" + `
+}
+
+type Config struct {
+	Type     string            ` + "`mapstructure:\"type\" mapstructure-to-hcl2:\",label\"`" + `
+	Name     string            ` + "`mapstructure:\"name\"`" + `
+	Tags     []string          ` + "`mapstructure:\"tags\"`" + `
+	Metadata map[string]string ` + "`mapstructure:\"metadata\"`" + `
+	Disk     Disk              ` + "`mapstructure:\"disk\"`" + `
+	Disks    []Disk            ` + "`mapstructure:\"disks\"`" + `
+	Any      interface{}       ` + "`mapstructure:\"any\"`" + `
+}
+`
+	var d Description
+	generateTestCode(t, src, Options{TypeNames: []string{"Config", "Disk"}, Description: &d})
+	b, err := json.MarshalIndent(d.Types[0], "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{
+  "name": "FlatConfig",
+  "original": "Config",
+  "labels": [
+    "type"
+  ],
+  "attributes": [
+    {
+      "name": "name",
+      "type": "string",
+      "required": false
+    },
+    {
+      "name": "tags",
+      "type": "list(string)",
+      "required": false
+    },
+    {
+      "name": "any",
+      "type": "any",
+      "required": false
+    }
+  ],
+  "blocks": [
+    {
+      "name": "metadata",
+      "nesting": "attrs",
+      "type": "string"
+    },
+    {
+      "name": "disk",
+      "nesting": "single",
+      "type": "FlatDisk"
+    },
+    {
+      "name": "disks",
+      "nesting": "list",
+      "type": "FlatDisk"
+    }
+  ]
+}`
+	if string(b) != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, b)
+	}
+	if d.Version != DescriptionVersion || len(d.Types) != 2 || d.Types[1].Name != "FlatDisk" {
+		t.Fatalf("unexpected description: %+v", d)
+	}
+}
+
+func TestDescription_selfDefined(t *testing.T) {
+	src := `package fixture
+
+import "github.com/hashicorp/hcl/v2/hcldec"
+
+type Settings map[string]string
+
+func (Settings) HCL2Spec() map[string]hcldec.Spec { return nil }
+
+type Config struct {
+	Settings Settings ` + "`mapstructure:\"settings\" mapstructure-to-hcl2:\",self-defined\"`" + `
+}
+`
+	var d Description
+	code := generateTestCode(t, src, Options{Description: &d})
+	expected := `"settings": &hcldec.BlockSpec{TypeName: "settings", Nested: hcldec.ObjectSpec((&Settings{}).HCL2Spec())}`
+	if !bytes.Contains(code, []byte(expected)) {
+		t.Fatalf("expected %s in:\n%s", expected, code)
+	}
+	blocks := d.Types[0].Blocks
+	if len(blocks) != 1 || blocks[0].Nesting != "single" || blocks[0].Type != "Settings" {
+		t.Fatalf("the description does not follow the spec: %+v", d.Types[0])
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	src := `package fixture
+
+type Disk struct {
+	Size int ` + "`mapstructure:\"size\"`" + `
+}
+
+type Config struct {
+	Type     string              ` + "`mapstructure:\"type\" mapstructure-to-hcl2:\",label\"`" + `
+	Name     string              ` + "`mapstructure:\"name\"`" + `
+	Count    *int                ` + "`mapstructure:\"count\"`" + `
+	Tags     []string            ` + "`mapstructure:\"tags\"`" + `
+	Ports    []map[string]int    ` + "`mapstructure:\"ports\"`" + `
+	Metadata map[string]string   ` + "`mapstructure:\"metadata\"`" + `
+	Disk     Disk                ` + "`mapstructure:\"disk\"`" + `
+	Mirrors  [2]Disk             ` + "`mapstructure:\"mirrors\"`" + `
+	Any      interface{}         ` + "`mapstructure:\"any\"`" + `
+}
+`
+	var d Description
+	generateTestCode(t, src, Options{TypeNames: []string{"Config", "Disk"}, Description: &d, RequiredFromNonPointer: true})
+	schema := d.JSONSchema("Config")
+	if schema.Schema != JSONSchemaDraft || schema.Ref != "#/definitions/FlatConfig" || len(schema.Definitions) != 2 {
+		t.Fatalf("unexpected schema: %+v", schema)
+	}
+	b, err := json.MarshalIndent(schema.Definitions["FlatConfig"], "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{
+  "type": "object",
+  "properties": {
+    "any": {},
+    "count": {
+      "type": "number"
+    },
+    "disk": {
+      "$ref": "#/definitions/FlatDisk"
+    },
+    "metadata": {
+      "type": "object",
+      "additionalProperties": {
+        "type": "string"
+      }
+    },
+    "mirrors": {
+      "type": "array",
+      "items": {
+        "$ref": "#/definitions/FlatDisk"
+      },
+      "minItems": 2,
+      "maxItems": 2
+    },
+    "name": {
+      "type": "string"
+    },
+    "ports": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "additionalProperties": {
+          "type": "number"
+        }
+      }
+    },
+    "tags": {
+      "type": "array",
+      "items": {
+        "type": "string"
+      }
+    }
+  },
+  "required": [
+    "name"
+  ],
+  "additionalProperties": false
+}`
+	if string(b) != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, b)
+	}
+
+	if schema := d.JSONSchema(""); schema.Ref != "" || len(schema.Definitions) != 2 {
+		t.Fatalf("expected definitions only, got %+v", schema)
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	src := `package fixture
+
+import "time"
+
+type Common struct {
+	Region string ` + "`mapstructure:\"region\"`" + `
+}
+
+type Disk struct {
+	Size int ` + "`mapstructure:\"size\"`" + `
+}
+
+type Config struct {
+	Common  ` + "`mapstructure:\",squash\"`" + `
+	Port    uint16        ` + "`mapstructure:\"port\"`" + `
+	Timeout time.Duration ` + "`mapstructure:\"timeout\"`" + `
+	Disks   []Disk        ` + "`mapstructure:\"disks\"`" + `
+}
+`
+	code := string(generateTestCode(t, src, Options{Annotate: true}))
+	expected := `}
+
+// The attributes and blocks of FlatConfig come from these Go types:
+//   region: string
+//   port: uint16
+//   timeout: time.Duration
+//   disks: []Disk
+
+`
+	if !strings.Contains(code, expected) {
+		t.Fatalf("expected the annotations after FlatConfig:\n%s\nin:\n%s", expected, code)
+	}
+	if !strings.Contains(code, "\n\n// FlatMapstructure returns a new FlatConfig.") {
+		t.Fatalf("expected the annotations not to be the doc of FlatMapstructure in:\n%s", code)
+	}
+
+	if code := generateTestCode(t, src, Options{}); bytes.Contains(code, []byte("come from these Go types")) {
+		t.Fatalf("expected no annotations without the option in:\n%s", code)
+	}
+}
+
+func TestCaptureRanges(t *testing.T) {
+	src := `package main
+
+type Config struct {
+	Name  string ` + "`mapstructure:\"name\"`" + `
+	Count int    ` + "`mapstructure:\"count\"`" + `
+	Unset string ` + "`mapstructure:\"unset\"`" + `
+}
+`
+	code := generateTestCode(t, src, Options{CaptureRanges: true})
+	if !bytes.Contains(code, []byte("func (c *FlatConfig) CaptureRanges(body hcl.Body) {")) {
+		t.Fatalf("expected a CaptureRanges method in:\n%s", code)
+	}
+
+	out := runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go": `package main
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty/gocty"
+)
+
+func main() {
+	src := "name = \"a\"\n\ncount = 2\n"
+	f, diags := hclsyntax.ParseConfig([]byte(src), "config.hcl", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		panic(diags)
+	}
+	var c FlatConfig
+	val, diags := hcldec.Decode(f.Body, hcldec.ObjectSpec(c.HCL2Spec()), nil)
+	if diags.HasErrors() {
+		panic(diags)
+	}
+	if err := gocty.FromCtyValue(val, &c); err != nil {
+		panic(err)
+	}
+	c.CaptureRanges(f.Body)
+	fmt.Println(len(c.HCL2Ranges), c.HCL2Ranges["name"], c.HCL2Ranges["count"])
+}
+`,
+	})
+	expected := "2 config.hcl:1,1-11 config.hcl:3,1-10\n"
+	if out != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+}
+
+func TestDynamic(t *testing.T) {
+	src := `package main
+
+type Config struct {
+	Metadata map[string]string ` + "`mapstructure:\"metadata\" mapstructure-to-hcl2:\",dynamic\"`" + `
+}
+`
+	code := generateTestCode(t, src, Options{})
+	for _, expected := range []string{
+		`"github.com/zclconf/go-cty/cty"`,
+		"Metadata cty.Value `mapstructure:\"metadata\" mapstructure-to-hcl2:\",dynamic\" cty:\"metadata\"`",
+		`"metadata": &hcldec.AttrSpec{Name: "metadata", Type: cty.DynamicPseudoType, Required: false}`,
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+
+	out := runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go": `package main
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty/gocty"
+)
+
+func main() {
+	src := "metadata = { a = [1, true] }\n"
+	f, diags := hclsyntax.ParseConfig([]byte(src), "config.hcl", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		panic(diags)
+	}
+	val, diags := hcldec.Decode(f.Body, hcldec.ObjectSpec((&FlatConfig{}).HCL2Spec()), nil)
+	if diags.HasErrors() {
+		panic(diags)
+	}
+	var c FlatConfig
+	if err := gocty.FromCtyValue(val, &c); err != nil {
+		panic(err)
+	}
+	fmt.Println(c.Metadata.GetAttr("a").Type().FriendlyName())
+}
+`,
+	})
+	expected := "tuple\n"
+	if out != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+}
+
+func TestLabel(t *testing.T) {
+	src := `package main
+
+type Provisioner struct {
+	Type   string   ` + "`mapstructure:\"type\" mapstructure-to-hcl2:\",label\"`" + `
+	Inline []string ` + "`mapstructure:\"inline\"`" + `
+}
+
+type Config struct {
+	Provisioners []Provisioner ` + "`mapstructure:\"provisioner\"`" + `
+}
+`
+	code := generateTestCode(t, src, Options{TypeNames: []string{"Config", "Provisioner"}})
+	expected := `"type":   &hcldec.BlockLabelSpec{Index: 0, Name: "type"},`
+	if !bytes.Contains(code, []byte(expected)) {
+		t.Fatalf("expected %s in:\n%s", expected, code)
+	}
+
+	out := runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go": `package main
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty/gocty"
+)
+
+func main() {
+	src := "provisioner \"shell\" {\n  inline = [\"a\"]\n}\nprovisioner \"file\" {}\n"
+	f, diags := hclsyntax.ParseConfig([]byte(src), "config.hcl", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		panic(diags)
+	}
+	val, diags := hcldec.Decode(f.Body, hcldec.ObjectSpec((&FlatConfig{}).HCL2Spec()), nil)
+	if diags.HasErrors() {
+		panic(diags)
+	}
+	var cfg FlatConfig
+	if err := gocty.FromCtyValue(val, &cfg); err != nil {
+		panic(err)
+	}
+	fmt.Println(*cfg.Provisioners[0].Type, cfg.Provisioners[0].Inline, *cfg.Provisioners[1].Type)
+}
+`,
+	})
+	if expected := "shell [a] file\n"; out != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+}
+
+func TestFixedArray(t *testing.T) {
+	src := `package main
+
+type Disk struct {
+	Size int ` + "`mapstructure:\"size\"`" + `
+}
+
+type Config struct {
+	Disks [3]Disk   ` + "`mapstructure:\"disks\"`" + `
+	Ports [2]int    ` + "`mapstructure:\"ports\"`" + `
+}
+`
+	code := generateTestCode(t, src, Options{TypeNames: []string{"Config", "Disk"}})
+	for _, expected := range []string{
+		"Disks [3]FlatDisk ",
+		`&hcldec.BlockListSpec{TypeName: "disks", Nested: hcldec.ObjectSpec((*FlatDisk)(nil).HCL2Spec()), MinItems: 3, MaxItems: 3}`,
+		`&hcldec.AttrSpec{Name: "ports", Type: cty.List(cty.Number), Required: false}`,
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+
+	out := runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go": `package main
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+func main() {
+	for _, src := range []string{
+		"disks {}\ndisks {}\ndisks {}\n",
+		"disks {}\n",
+	} {
+		f, diags := hclsyntax.ParseConfig([]byte(src), "config.hcl", hcl.Pos{Line: 1, Column: 1})
+		if diags.HasErrors() {
+			panic(diags)
+		}
+		_, diags = hcldec.Decode(f.Body, hcldec.ObjectSpec((&FlatConfig{}).HCL2Spec()), nil)
+		fmt.Println(diags.HasErrors())
+	}
+}
+`,
+	})
+	if expected := "false\ntrue\n"; out != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+}
+
+func TestList(t *testing.T) {
+	src := `package fixture
+
+type Nested struct {
+	Value string ` + "`mapstructure:\"value\"`" + `
+}
+
+type Config struct {
+	Name   string    ` + "`mapstructure:\"name\"`" + `
+	Events chan int  ` + "`mapstructure:\"events\"`" + `
+	Nested Nested    ` + "`mapstructure:\"nested\"`" + `
+}
+`
+	out := generateTestCode(t, src, Options{TypeNames: []string{"Config", "Nested"}, List: true})
+	expected := "FlatConfig: 3 field(s)\n\tEvents: unhandled type chan int\nFlatNested: 1 field(s)\n"
+	if string(out) != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+}
+
+func TestConflictingAccessors(t *testing.T) {
+	src := `package fixture
+
+type A struct {
+	Foo string ` + "`mapstructure:\"foo\"`" + `
+}
+
+type B struct {
+	Bar int ` + "`mapstructure:\"foo\"`" + `
+}
+
+type Config struct {
+	A ` + "`mapstructure:\",squash\"`" + `
+	B ` + "`mapstructure:\",squash\"`" + `
+}
+`
+	_, err := generate(loadTestPackage(t, src), Options{TypeNames: []string{"Config"}})
+	if err == nil {
+		t.Fatal("expected a conflicting cty name error without Strict")
+	}
+	for _, expected := range []string{"conflicting", `"foo"`, "A.Foo (*string)", "B.Bar (*int)"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected %s in error: %v", expected, err)
+		}
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	src := `package main
+
+type L4 struct {
+	D string ` + "`mapstructure:\"d\"`" + `
+}
+
+type L3 struct {
+	L4 ` + "`mapstructure:\",squash\"`" + `
+	C  string ` + "`mapstructure:\"c\"`" + `
+}
+
+type L2 struct {
+	L3 ` + "`mapstructure:\",squash\"`" + `
+	B  string ` + "`mapstructure:\"b\"`" + `
+}
+
+type L1 struct {
+	L2 ` + "`mapstructure:\",squash\"`" + `
+	A  string ` + "`mapstructure:\"a\"`" + `
+}
+
+type Config struct {
+	L1   ` + "`mapstructure:\",squash\"`" + `
+	Name string ` + "`mapstructure:\"name\"`" + `
+}
+`
+	code := generateTestCode(t, src, Options{TypeNames: []string{"Config", "L3"}, MaxDepth: 2})
+	for _, expected := range []string{
+		`"a":    &hcldec.AttrSpec{Name: "a", Type: cty.String, Required: false}`,
+		`"b":    &hcldec.AttrSpec{Name: "b", Type: cty.String, Required: false}`,
+		`"l3":   &hcldec.BlockSpec{TypeName: "l3", Nested: hcldec.ObjectSpec((*FlatL3)(nil).HCL2Spec())}`,
+		// FlatL3 is generated from depth 0.
+		`"d": &hcldec.AttrSpec{Name: "d", Type: cty.String, Required: false}`,
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("expected %s in:\n%s", expected, code)
+		}
+	}
+
+	runGenerated(t, map[string]string{
+		"config.go":          src,
+		"config.hcl2spec.go": string(code),
+		"main.go":            "package main\n\nfunc main() { _ = FlatConfig{} }\n",
+	})
+}
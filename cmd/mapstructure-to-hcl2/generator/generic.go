@@ -0,0 +1,11 @@
+//go:build go1.18
+// +build go1.18
+
+package generator
+
+import "go/types"
+
+// isGeneric tells whether t has type parameters, ex: `type Config[T any]`.
+func isGeneric(t *types.Named) bool {
+	return t.TypeParams().Len() > 0
+}
@@ -0,0 +1,11 @@
+//go:build !go1.18
+// +build !go1.18
+
+package generator
+
+import "go/types"
+
+// isGeneric returns false, there are no type parameters before go1.18.
+func isGeneric(t *types.Named) bool {
+	return false
+}
@@ -0,0 +1,109 @@
+package generator
+
+import (
+	"strings"
+)
+
+// JSONSchemaDraft is the JSON Schema version of the schemas of JSONSchema.
+const JSONSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// JSONSchema is a JSON Schema of the bodies of the generated Flat structs,
+// for editors and external validators. Only the keywords this generator
+// needs are set.
+type JSONSchema struct {
+	Schema      string                 `json:"$schema,omitempty"`
+	Ref         string                 `json:"$ref,omitempty"`
+	Definitions map[string]*JSONSchema `json:"definitions,omitempty"`
+	Type        string                 `json:"type,omitempty"`
+	Properties  map[string]*JSONSchema `json:"properties,omitempty"`
+	Required    []string               `json:"required,omitempty"`
+	// AdditionalProperties is false for the bodies, whose attributes and
+	// blocks are known, or the schema of the values of a map.
+	AdditionalProperties interface{} `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema `json:"items,omitempty"`
+	MinItems             int         `json:"minItems,omitempty"`
+	MaxItems             int         `json:"maxItems,omitempty"`
+}
+
+// JSONSchema translates d into a JSON Schema defining each Flat struct, the
+// schema refers to the Flat struct of root, ex: Config, when it is described.
+// Blocks are set as objects, or arrays of objects when they can be repeated,
+// like in the JSON syntax of HCL; the labels of a type are not part of its
+// body and are left out.
+func (d Description) JSONSchema(root string) *JSONSchema {
+	s := &JSONSchema{Schema: JSONSchemaDraft, Definitions: map[string]*JSONSchema{}}
+	defined := map[string]bool{}
+	for _, td := range d.Types {
+		defined[td.Name] = true
+	}
+	for _, td := range d.Types {
+		s.Definitions[td.Name] = typeJSONSchema(td, defined)
+		if root != "" && td.Original == root {
+			s.Ref = "#/definitions/" + td.Name
+		}
+	}
+	return s
+}
+
+// typeJSONSchema returns the schema of the body of td, defined are the names
+// of the Flat structs that have a definition.
+func typeJSONSchema(td TypeDescription, defined map[string]bool) *JSONSchema {
+	s := &JSONSchema{
+		Type:                 "object",
+		Properties:           map[string]*JSONSchema{},
+		AdditionalProperties: false,
+	}
+	for _, attr := range td.Attributes {
+		s.Properties[attr.Name] = ctyTypeJSONSchema(attr.Type)
+		if attr.Required {
+			s.Required = append(s.Required, attr.Name)
+		}
+	}
+	for _, block := range td.Blocks {
+		switch block.Nesting {
+		case "attrs":
+			s.Properties[block.Name] = &JSONSchema{Type: "object", AdditionalProperties: ctyTypeJSONSchema(block.Type)}
+		case "list":
+			s.Properties[block.Name] = &JSONSchema{
+				Type:     "array",
+				Items:    blockTypeJSONSchema(block.Type, defined),
+				MinItems: block.MinItems,
+				MaxItems: block.MaxItems,
+			}
+		default:
+			s.Properties[block.Name] = blockTypeJSONSchema(block.Type, defined)
+		}
+	}
+	return s
+}
+
+// blockTypeJSONSchema returns the schema of a block of typ, the name of a
+// Flat struct or the cty type of a list of values, see BlockDescription. The
+// Flat structs that are not defined, ex: generated in another package, are
+// only known to be objects.
+func blockTypeJSONSchema(typ string, defined map[string]bool) *JSONSchema {
+	if defined[typ] {
+		return &JSONSchema{Ref: "#/definitions/" + typ}
+	}
+	if s := ctyTypeJSONSchema(typ); s.Type != "" || typ == "any" {
+		return s
+	}
+	return &JSONSchema{Type: "object"}
+}
+
+// ctyTypeJSONSchema returns the schema of the values of typ, a type written
+// by ctyTypeString, ex: list(string). Unknown types, like any, accept any
+// value.
+func ctyTypeJSONSchema(typ string) *JSONSchema {
+	switch {
+	case typ == "string", typ == "number":
+		return &JSONSchema{Type: typ}
+	case typ == "bool":
+		return &JSONSchema{Type: "boolean"}
+	case strings.HasPrefix(typ, "list(") && strings.HasSuffix(typ, ")"):
+		return &JSONSchema{Type: "array", Items: ctyTypeJSONSchema(typ[len("list(") : len(typ)-1])}
+	case strings.HasPrefix(typ, "map(") && strings.HasSuffix(typ, ")"):
+		return &JSONSchema{Type: "object", AdditionalProperties: ctyTypeJSONSchema(typ[len("map(") : len(typ)-1])}
+	}
+	return &JSONSchema{}
+}
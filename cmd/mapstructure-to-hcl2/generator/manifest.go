@@ -0,0 +1,63 @@
+package generator
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+)
+
+// Manifest records the hash of the flattened form of each generated struct,
+// keyed by the name of its Flat struct. With Options.OnlyChanged, the code
+// of the structs whose hash did not change is copied from the previous
+// generation instead of being generated again.
+type Manifest map[string]string
+
+// structHash returns the hash of the flattened form of def and of the
+// options it is generated with. Since the Struct string holds the type and
+// tags of every field, any change to the original struct that changes the
+// generated code changes its hash.
+func structHash(def StructDef, opts Options) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s %+v %s", def.OriginalStructName, def.StructName, hashedOptions(opts), def.Struct)
+	for _, t := range def.MergedSpecs {
+		fmt.Fprintf(h, " %s", t)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// hashedOptions returns opts without the options that can't change the code
+// of a Flat struct, so that a change to any other one, including an option
+// added later, regenerates it. The FieldTransformers funcs can't be printed,
+// their changes are in the flattened struct.
+func hashedOptions(opts Options) Options {
+	opts.Patterns, opts.BuildTags, opts.CommandLine = nil, "", ""
+	opts.Header, opts.HeaderBeforeMarker = "", false
+	opts.OnlyChanged, opts.Previous, opts.Manifest, opts.Description = false, nil, nil, nil
+	opts.FieldTransformers, opts.log = nil, nil
+	return opts
+}
+
+// sectionStart matches the comment starting the code of each Flat struct.
+var sectionStart = regexp.MustCompile(`(?m)^// (\w+) is an auto-generated flat version of`)
+
+// splitSections returns the code of each Flat struct of code, keyed by its
+// name. A section goes from the comment of the struct to the next one.
+func splitSections(code []byte) map[string][]byte {
+	sections := map[string][]byte{}
+	var matches [][]int
+	for _, m := range sectionStart.FindAllSubmatchIndex(code, -1) {
+		// the FlatMapstructure doc repeats the comment of the struct.
+		if !bytes.HasSuffix(code[:m[0]], []byte(" returns a new "+string(code[m[2]:m[3]])+".\n")) {
+			matches = append(matches, m)
+		}
+	}
+	for i, m := range matches {
+		end := len(code)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		sections[string(code[m[2]:m[3]])] = code[m[0]:end]
+	}
+	return sections
+}
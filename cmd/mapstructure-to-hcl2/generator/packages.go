@@ -0,0 +1,122 @@
+package generator
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// PackageCode is the code generated for one of the packages matched by
+// Options.Patterns, see GeneratePackages.
+type PackageCode struct {
+	PkgPath string
+	// Dir is the directory of the package, where its code goes.
+	Dir  string
+	Code []byte
+}
+
+// GeneratePackages loads the packages matched by opts.Patterns, ex:
+// ./builder/..., and generates the code of each of them that has some of
+// opts.TypeNames, or config-like types with opts.All, or implementations of
+// opts.Implementing. The packages are independent, so up to concurrency of
+// them are generated at a time, their logs are then printed in order, each
+// line prefixed with its package path. The options set once per generation,
+// Manifest and Description, are not supported.
+func GeneratePackages(opts Options, concurrency int) ([]PackageCode, error) {
+	if len(opts.TypeNames) == 0 && !opts.All && opts.Implementing == "" {
+		return nil, fmt.Errorf("no type names given")
+	}
+	if opts.Manifest != nil || opts.Description != nil {
+		return nil, fmt.Errorf("a manifest or a description can only be generated for one package")
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	pkgs, err := loadPackages(opts, packages.LoadSyntax)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pkgs, func(i, j int) bool {
+		return pkgs[i].PkgPath < pkgs[j].PkgPath
+	})
+	var matched []*packages.Package
+	for _, pkg := range pkgs {
+		if len(pkg.GoFiles) > 0 && hasTypes(pkg, opts) {
+			matched = append(matched, pkg)
+		}
+	}
+
+	// each worker only writes to the result and the logs of its package.
+	codes := make([]PackageCode, len(matched))
+	errs := make([]error, len(matched))
+	logs := make([]*logger, len(matched))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, pkg := range matched {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, pkg *packages.Package) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if errs[i] = loadErrors(pkg); errs[i] != nil {
+				return
+			}
+			opts := opts
+			opts.log = &logger{buffered: true}
+			logs[i] = opts.log
+			code, err := generate(pkg, opts)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %v", pkg.PkgPath, err)
+				return
+			}
+			codes[i] = PackageCode{PkgPath: pkg.PkgPath, Dir: filepath.Dir(pkg.GoFiles[0]), Code: code}
+		}(i, pkg)
+	}
+	wg.Wait()
+	// the logs are printed in the order of the packages rather than as they
+	// come, each line telling its package.
+	for i, l := range logs {
+		if l == nil {
+			continue
+		}
+		for _, line := range l.lines {
+			log.Printf("%s: %s", matched[i].PkgPath, line)
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// hasTypes tells whether pkg has some of the types to generate, so that the
+// packages without any are skipped rather than warned about.
+func hasTypes(pkg *packages.Package, opts Options) bool {
+	excluded := map[string]bool{}
+	for _, name := range opts.ExcludeTypes {
+		excluded[name] = true
+	}
+	names := opts.TypeNames
+	if opts.All {
+		names = append(configTypeNames(pkg), names...)
+	}
+	if opts.Implementing != "" {
+		// the packages without the marker interface have no implementation.
+		implementing, _ := implementingTypeNames(pkg, opts.Implementing)
+		names = append(implementing, names...)
+	}
+	for _, name := range names {
+		if !excluded[name] && pkg.Types.Scope().Lookup(name) != nil {
+			return true
+		}
+	}
+	return false
+}
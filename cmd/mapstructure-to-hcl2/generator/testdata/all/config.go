@@ -0,0 +1,26 @@
+package all
+
+type Config struct {
+	Name    string  `mapstructure:"name"`
+	Network Network `mapstructure:"network"`
+}
+
+type Network struct {
+	CIDR string `mapstructure:"cidr"`
+}
+
+// Internal is excluded with -exclude-type.
+type Internal struct {
+	ID string `mapstructure:"id"`
+}
+
+// Plain has no mapstructure tag, it is not config-like.
+type Plain struct {
+	Name string
+}
+
+type hidden struct {
+	Name string `mapstructure:"name"`
+}
+
+type Mode string
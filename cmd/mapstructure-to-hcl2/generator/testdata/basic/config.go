@@ -0,0 +1,10 @@
+package basic
+
+type Nested struct {
+	Value string `mapstructure:"value"`
+}
+
+type Config struct {
+	Name   string `mapstructure:"name"`
+	Nested Nested `mapstructure:"nested"`
+}
@@ -0,0 +1,12 @@
+package external
+
+type Mode string
+
+type Nested struct {
+	Value string `mapstructure:"value"`
+}
+
+type Config struct {
+	Mode   Mode   `mapstructure:"mode"`
+	Nested Nested `mapstructure:"nested"`
+}
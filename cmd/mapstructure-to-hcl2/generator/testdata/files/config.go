@@ -0,0 +1,6 @@
+package files
+
+type Config struct {
+	Name   string `mapstructure:"name"`
+	Nested Nested `mapstructure:"nested"`
+}
@@ -0,0 +1,5 @@
+package files
+
+type Nested struct {
+	Value string `mapstructure:"value"`
+}
@@ -0,0 +1,8 @@
+package comm
+
+import "github.com/hashicorp/packer/cmd/mapstructure-to-hcl2/generator/testdata/impl/ssh"
+
+// Communicator is set with a `mapstructure:",impl=path/to/pkg.Type"` tag.
+type Communicator interface{}
+
+var _ Communicator = ssh.Config{}
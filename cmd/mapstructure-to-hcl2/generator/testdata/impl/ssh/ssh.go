@@ -0,0 +1,6 @@
+package ssh
+
+type Config struct {
+	Host string `mapstructure:"host"`
+	Port int    `mapstructure:"port"`
+}
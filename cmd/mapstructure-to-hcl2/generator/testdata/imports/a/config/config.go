@@ -0,0 +1,7 @@
+package config
+
+type Settings map[string]string
+
+type Common struct {
+	Settings Settings `mapstructure:"a_settings"`
+}
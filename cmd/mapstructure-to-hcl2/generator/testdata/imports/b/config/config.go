@@ -0,0 +1,7 @@
+package config
+
+type Settings map[string]string
+
+type Common struct {
+	Extra map[string]Settings `mapstructure:"b_extra"`
+}
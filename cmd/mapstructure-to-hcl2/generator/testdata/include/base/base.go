@@ -0,0 +1,5 @@
+package base
+
+type Base struct {
+	Region string `mapstructure:"region"`
+}
@@ -0,0 +1,10 @@
+package a
+
+type Disk struct {
+	Size int `mapstructure:"size"`
+}
+
+type Config struct {
+	Name  string `mapstructure:"name"`
+	Disks []Disk `mapstructure:"disks"`
+}
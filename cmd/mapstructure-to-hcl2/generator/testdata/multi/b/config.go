@@ -0,0 +1,8 @@
+package b
+
+type Mode string
+
+type Config struct {
+	Region string `mapstructure:"region"`
+	Mode   Mode   `mapstructure:"mode"`
+}
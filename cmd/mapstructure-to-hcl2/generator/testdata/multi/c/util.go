@@ -0,0 +1,6 @@
+package c
+
+// Util has no mapstructure tag, c is skipped.
+type Util struct {
+	Value string
+}
@@ -0,0 +1,5 @@
+package nested
+
+type Config struct {
+	Name string `mapstructure:"name"`
+}
@@ -0,0 +1,22 @@
+package common
+
+import (
+	"time"
+
+	"github.com/hashicorp/packer/cmd/mapstructure-to-hcl2/generator/testdata/external"
+)
+
+type Mode string
+
+type Disk struct {
+	Size int `mapstructure:"size"`
+}
+
+// Common is squashed into the configs of other packages.
+type Common struct {
+	Mode     Mode            `mapstructure:"mode"`
+	Disks    []Disk          `mapstructure:"disks"`
+	Timeout  time.Duration   `mapstructure:"timeout"`
+	External external.Mode   `mapstructure:"external"`
+	Nested   external.Nested `mapstructure:"nested"`
+}
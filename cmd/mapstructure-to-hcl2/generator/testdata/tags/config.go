@@ -0,0 +1,7 @@
+//go:build !extra
+
+package tags
+
+type Config struct {
+	Name string `mapstructure:"name"`
+}
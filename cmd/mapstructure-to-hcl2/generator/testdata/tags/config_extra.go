@@ -0,0 +1,8 @@
+//go:build extra
+
+package tags
+
+type Config struct {
+	Name  string `mapstructure:"name"`
+	Extra string `mapstructure:"extra"`
+}
@@ -0,0 +1,5 @@
+package tests
+
+type Config struct {
+	Name string `mapstructure:"name"`
+}
@@ -0,0 +1,6 @@
+package tests
+
+type FixtureConfig struct {
+	Config `mapstructure:",squash"`
+	Extra  string `mapstructure:"extra"`
+}
@@ -0,0 +1,5 @@
+package tests_test
+
+type ExternalConfig struct {
+	Value string `mapstructure:"value"`
+}
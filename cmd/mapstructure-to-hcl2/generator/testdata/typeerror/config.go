@@ -0,0 +1,5 @@
+package typeerror
+
+type Config struct {
+	Name Unknown `mapstructure:"name"`
+}
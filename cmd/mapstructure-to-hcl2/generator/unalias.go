@@ -0,0 +1,13 @@
+//go:build go1.22
+// +build go1.22
+
+package generator
+
+import "go/types"
+
+// unalias returns the type t is an alias of, ex: time.Duration for a
+// `type MyDur = time.Duration`. Since go1.22, go/types can represent
+// aliases as types of their own.
+func unalias(t types.Type) types.Type {
+	return types.Unalias(t)
+}
@@ -0,0 +1,11 @@
+//go:build !go1.22
+// +build !go1.22
+
+package generator
+
+import "go/types"
+
+// unalias returns t, go/types resolves aliases to their type before go1.22.
+func unalias(t types.Type) types.Type {
+	return t
+}
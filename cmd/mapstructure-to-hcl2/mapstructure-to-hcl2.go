@@ -8,13 +8,13 @@
 //
 // Here are a few differences/gaps betweens hcl2 and mapstructure:
 //
-//  * in HCL2 all basic struct fields (string/int/struct) that are not pointers
-//   are required ( must be set ). In mapstructure everything is optional.
+//   - in HCL2 all basic struct fields (string/int/struct) that are not pointers
+//     are required ( must be set ). In mapstructure everything is optional.
 //
-//  * mapstructure allows to 'squash' fields
-//  (ex: Field CommonStructType `mapstructure:",squash"`) this allows to
-//  decorate structs and reuse configuration code. HCL2 parsing libs don't have
-//  anything similar.
+//   - mapstructure allows to 'squash' fields
+//     (ex: Field CommonStructType `mapstructure:",squash"`) this allows to
+//     decorate structs and reuse configuration code. HCL2 parsing libs don't have
+//     anything similar.
 //
 // mapstructure-to-hcl2 will parse Packer's config files and generate the HCL2
 // compliant code that will allow to not change any of the current builders in
@@ -22,35 +22,71 @@
 package main
 
 import (
-	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
-	"go/format"
-	"go/types"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
-	"regexp"
-	"sort"
+	"path/filepath"
+	"strconv"
 	"strings"
 
-	"github.com/fatih/structtag"
-	"github.com/hashicorp/hcl/v2/hcldec"
-	"github.com/zclconf/go-cty/cty"
-
-	"golang.org/x/tools/go/packages"
+	"github.com/hashicorp/packer/cmd/mapstructure-to-hcl2/generator"
 )
 
 var (
-	typeNames  = flag.String("type", "", "comma-separated list of type names; must be set")
-	output     = flag.String("output", "", "output file name; default srcdir/<type>_hcl2.go")
-	trimprefix = flag.String("trimprefix", "", "trim the `prefix` from the generated constant names")
+	typeNames      = flag.String("type", "", "comma-separated list of type names; must be set unless -all or -implementing is")
+	all            = flag.Bool("all", false, "also generate every config-like type of the package: exported structs with a mapstructure tag")
+	implementing   = flag.String("implementing", "", "also generate every struct type of the package implementing the marker `interface`, ex: Configurer or github.com/foo/bar.Configurer")
+	excludeTypes   = flag.String("exclude-type", "", "comma-separated list of type names not to generate, ex: to use with -all")
+	output         = flag.String("output", "", "output file name; default <package dir>/<type>.hcl2spec.go")
+	fileMode       = flag.String("file-mode", "", "octal permissions of the output file, ex: 0644; default to 0666 before umask")
+	headerFile     = flag.String("header-file", "", "write the contents of `file` at the top of the generated file, ex: a license header")
+	headerBefore   = flag.Bool("header-before-marker", false, "write the -header-file before the code generated marker rather than after it")
+	packageName    = flag.String("package", "", "package name of the generated code; default to the package of the types")
+	buildTags      = flag.String("tags", "", "comma-separated list of build tags to apply when loading the package")
+	tests          = flag.Bool("tests", false, "also load the _test.go files of the package, to generate test fixture types; the output is then a _test.go file")
+	trimprefix     = flag.String("trimprefix", "", "trim the `prefix` from the type names before prefixing them with Flat")
+	noFallback     = flag.Bool("no-fallback", false, "fail when the type of a field could not be found instead of generating a TODO bool spec")
+	toCtyValue     = flag.Bool("to-cty-value", false, "generate a ToCtyValue method converting a Flat struct to a cty value")
+	decodeCty      = flag.Bool("decode-cty-value", false, "generate a DecodeCtyValue method decoding a cty object value with the HCL2Spec of a Flat struct, for tests")
+	emptyAsNull    = flag.Bool("empty-slices-as-null", false, "make the ToCtyValue methods convert empty slices to null, like nil slices")
+	captureRanges  = flag.Bool("capture-ranges", false, "generate a HCL2Ranges field holding the source range of each decoded attribute")
+	ctyToField     = flag.Bool("cty-to-field-name", false, "generate a CtyToFieldName method mapping the cty name of each field of a Flat struct to the field name")
+	emitHCLTags    = flag.Bool("emit-hcl-tags", false, "add hcl tags to the generated structs for gohcl")
+	emitStringer   = flag.Bool("emit-stringer", false, "generate a String method showing the field values of each Flat struct, for debugging")
+	annotate       = flag.Bool("annotate", false, "write a comment after each Flat struct listing the Go type of each of its fields, for reviews")
+	ignoreFields   = flag.String("ignore-fields", "", "comma-separated list of field names to skip, ex: mapstructure metadata fields")
+	initialisms    = flag.String("initialisms", "", "comma-separated list of mixed case initialisms to keep as one word in the snake cased names of untagged fields, ex: NetApp; added to the default ones like IPv4")
+	fieldRenames   = flag.String("field-renames", "", "comma-separated list of Struct.Field=name cty names, to resolve the collisions of squashed fields")
+	list           = flag.Bool("list", false, "print the types that would be generated, their number of fields and their unhandled fields instead of generating them")
+	maxDepth       = flag.Int("max-depth", 0, "number of levels of squashed structs to flatten, deeper ones are delegated to their own Flat type; 0 means no limit")
+	strict         = flag.Bool("strict", false, "fail when some of the types are not found or when squashed fields share a name instead of warning")
+	specManifest   = flag.String("manifest", "", "also write a JSON description of the generated specs to `path`, for tooling")
+	jsonSchema     = flag.String("jsonschema", "", "also write a JSON Schema of the generated specs to `path`, for editor completion and external validation")
+	onlyChanged    = flag.Bool("only-changed", false, "only regenerate the types that changed since the last generation, recorded in a <output>.manifest file")
+	requiredFromNP = flag.Bool("required-from-nonpointer", false, "make the basic fields that are not pointers required, and keep them non pointers")
+	noPtrBasics    = flag.Bool("no-pointer-basics", false, "keep all the basic fields non pointers, they are then all required")
+	requiredFields = flag.String("required-fields", "", "comma-separated list of the names of basic attributes to make required, and keep non pointers, ex: to tighten a config gradually")
+	keepZero       = flag.Bool("keep-zero-value-distinction", false, "set the optional basic fields as config.Nullable values telling whether they were set rather than as pointers")
+	includeNested  = flag.Bool("include-nested", false, "also generate the struct types of the package that the generated Flat structs refer to")
+	unexported     = flag.Bool("include-unexported", false, "name the Flat types of unexported types like exported ones, ex: FlatConfig for config")
+	lintSelfDef    = flag.Bool("lint-self-defined", false, "warn about the struct fields whose type has a HCL2Spec method but that are not tagged self-defined")
+	squashEmbedded = flag.Bool("squash-embedded", false, "squash embedded structs without a mapstructure name, like Go promotes their fields")
+	concurrent     = flag.Int("concurrent", 0, "generate every package matched by the patterns, ex: ./builder/..., next to their sources, `n` at a time")
+	collapse       = flag.Bool("collapse-wrappers", false, "set the fields of method-less structs wrapping a single basic value as that value, like with the unwrap option")
 )
 
 // Usage is a replacement usage function for the flags package.
 func Usage() {
 	fmt.Fprintf(os.Stderr, "Usage of mapstructure-to-hcl2:\n")
 	fmt.Fprintf(os.Stderr, "\tflatten-mapstructure [flags] -type T[,T...] pkg\n")
+	fmt.Fprintf(os.Stderr, "\tflatten-mapstructure [flags] -type T[,T...] file.go...\n")
+	fmt.Fprintf(os.Stderr, "\tflatten-mapstructure [flags] -all [-exclude-type T[,T...]] pkg\n")
+	fmt.Fprintf(os.Stderr, "\tflatten-mapstructure [flags] -implementing I pkg\n")
+	fmt.Fprintf(os.Stderr, "\tflatten-mapstructure [flags] -concurrent n -all pkg/...\n")
 	fmt.Fprintf(os.Stderr, "Flags:\n")
 	flag.PrintDefaults()
 }
@@ -60,478 +96,268 @@ func main() {
 	log.SetPrefix("mapstructure-to-hcl2: ")
 	flag.Usage = Usage
 	flag.Parse()
-	if len(*typeNames) == 0 {
+	if len(*typeNames) == 0 && !*all && *implementing == "" {
 		flag.Usage()
 		os.Exit(2)
 	}
-	typeNames := strings.Split(*typeNames, ",")
+	var names []string
+	if *typeNames != "" {
+		names = strings.Split(*typeNames, ",")
+	}
+
+	if *concurrent > 0 && (*output != "" || *specManifest != "" || *jsonSchema != "" || *onlyChanged || *list) {
+		log.Fatalf("-concurrent can't be used with -output, -manifest, -jsonschema, -only-changed or -list, which are for one package")
+	}
 
 	// We accept either one directory or a list of files. Which do we have?
 	args := flag.Args()
-	if len(args) == 0 {
-		// Default: process whole package in current directory.
-		args = []string{"."}
+	// the -all and -implementing types are config-like.
+	first := "config"
+	if len(names) > 0 {
+		first = names[0]
 	}
-	outputPath := strings.ToLower(typeNames[0]) + ".hcl2spec.go"
-	if goFile := os.Getenv("GOFILE"); goFile != "" {
-		outputPath = goFile[:len(goFile)-2] + "hcl2spec.go"
+	name := outputName(first, os.Getenv("GOFILE"), *tests)
+	outputPath := *output
+	if outputPath == "" && *concurrent == 0 {
+		// next to the sources, whatever the current directory.
+		dir, err := generator.PackageDir(generator.Options{Patterns: args, BuildTags: *buildTags, Tests: *tests})
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
+		outputPath = filepath.Join(dir, name)
 	}
-	log.SetPrefix(fmt.Sprintf("mapstructure-to-hcl2: %s.%v: ", os.Getenv("GOPACKAGE"), typeNames))
+	log.SetPrefix(fmt.Sprintf("mapstructure-to-hcl2: %s.%v: ", os.Getenv("GOPACKAGE"), names))
 
-	cfg := &packages.Config{
-		Mode: packages.LoadSyntax,
-	}
-	pkgs, err := packages.Load(cfg, args...)
-	if err != nil {
-		log.Fatal(err)
+	var excluded []string
+	if *excludeTypes != "" {
+		excluded = strings.Split(*excludeTypes, ",")
 	}
-	if len(pkgs) != 1 {
-		log.Fatalf("error: %d packages found", len(pkgs))
+
+	var ignored []string
+	if *ignoreFields != "" {
+		ignored = strings.Split(*ignoreFields, ",")
 	}
-	topPkg := pkgs[0]
-	sort.Strings(typeNames)
 
-	var structs []StructDef
-	usedImports := map[NamePath]*types.Package{}
+	if *initialisms != "" {
+		generator.MixedCaseInitialisms = append(generator.MixedCaseInitialisms, strings.Split(*initialisms, ",")...)
+	}
 
-	for id, obj := range topPkg.TypesInfo.Defs {
-		if obj == nil {
-			continue
-		}
-		t := obj.Type()
-		nt, isANamedType := t.(*types.Named)
-		if !isANamedType {
-			continue
-		}
-		if nt.Obj().Pkg() != topPkg.Types {
-			// Sometimes a struct embeds another struct named the same. ex:
-			// builder/osc/bsuvolume.BlockDevice. This makes sure the type is
-			// defined in topPkg.
-			continue
-		}
-		ut := nt.Underlying()
-		utStruct, utOk := ut.(*types.Struct)
-		if !utOk {
-			continue
-		}
-		pos := sort.SearchStrings(typeNames, id.Name)
-		if pos >= len(typeNames) || typeNames[pos] != id.Name {
-			continue // not a struct we care about
-		}
-		// make sure each type is found once where somehow sometimes they can be found twice
-		typeNames = append(typeNames[:pos], typeNames[pos+1:]...)
-		flatenedStruct := getMapstructureSquashedStruct(obj.Pkg(), utStruct)
-		flatenedStruct = addCtyTagToStruct(flatenedStruct)
-		newStructName := "Flat" + id.Name
-		structs = append(structs, StructDef{
-			OriginalStructName: id.Name,
-			StructName:         newStructName,
-			Struct:             flatenedStruct,
-		})
+	var required []string
+	if *requiredFields != "" {
+		required = strings.Split(*requiredFields, ",")
+	}
 
-		for k, v := range getUsedImports(flatenedStruct) {
-			if _, found := usedImports[k]; !found {
-				usedImports[k] = v
+	renames := map[string]string{}
+	if *fieldRenames != "" {
+		for _, rename := range strings.Split(*fieldRenames, ",") {
+			i := strings.Index(rename, "=")
+			if i < 0 || !strings.Contains(rename[:i], ".") {
+				log.Fatalf("invalid -field-renames %q: expected Struct.Field=name", rename)
 			}
+			renames[rename[:i]] = rename[i+1:]
 		}
 	}
 
-	out := bytes.NewBuffer(nil)
-
-	fmt.Fprintf(out, `// Code generated by "mapstructure-to-hcl2 %s"; DO NOT EDIT.`, strings.Join(os.Args[1:], " "))
-	fmt.Fprintf(out, "\npackage %s\n", topPkg.Name)
-
-	delete(usedImports, NamePath{topPkg.Name, topPkg.PkgPath})
-	usedImports[NamePath{"hcldec", "github.com/hashicorp/hcl/v2/hcldec"}] = types.NewPackage("hcldec", "github.com/hashicorp/hcl/v2/hcldec")
-	usedImports[NamePath{"cty", "github.com/zclconf/go-cty/cty"}] = types.NewPackage("cty", "github.com/zclconf/go-cty/cty")
-	outputImports(out, usedImports)
-
-	sort.Slice(structs, func(i int, j int) bool {
-		return structs[i].OriginalStructName < structs[j].OriginalStructName
-	})
-	for _, flatenedStruct := range structs {
-		fmt.Fprintf(out, "\n// %s is an auto-generated flat version of %s.", flatenedStruct.StructName, flatenedStruct.OriginalStructName)
-		fmt.Fprintf(out, "\n// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.")
-		fmt.Fprintf(out, "\ntype %s struct {\n", flatenedStruct.StructName)
-		outputStructFields(out, flatenedStruct.Struct)
-		fmt.Fprint(out, "}\n")
-
-		fmt.Fprintf(out, "\n// FlatMapstructure returns a new %s.", flatenedStruct.StructName)
-		fmt.Fprintf(out, "\n// %s is an auto-generated flat version of %s.", flatenedStruct.StructName, flatenedStruct.OriginalStructName)
-		fmt.Fprintf(out, "\n// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.")
-		fmt.Fprintf(out, "\nfunc (*%s) FlatMapstructure() interface{} {", flatenedStruct.OriginalStructName)
-		fmt.Fprintf(out, "return new(%s)", flatenedStruct.StructName)
-		fmt.Fprint(out, "}\n")
-
-		fmt.Fprintf(out, "\n// HCL2Spec returns the hcldec.Spec of a %s.", flatenedStruct.StructName)
-		fmt.Fprintf(out, "\n// This spec is used by HCL to read the fields of %s.", flatenedStruct.StructName)
-		fmt.Fprintf(out, "\nfunc (*%s) HCL2Spec() map[string]hcldec.Spec {\n", flatenedStruct.StructName)
-		outputStructHCL2SpecBody(out, flatenedStruct.Struct)
-		fmt.Fprint(out, "}\n")
+	var header []byte
+	if *headerFile != "" {
+		b, err := ioutil.ReadFile(*headerFile)
+		if err != nil {
+			log.Fatalf("failed to read header: %v", err)
+		}
+		header = b
 	}
 
-	for impt := range usedImports {
-		if strings.ContainsAny(impt.Path, "/") {
-			out = bytes.NewBuffer(bytes.ReplaceAll(out.Bytes(),
-				[]byte(impt.Path+"."),
-				[]byte(impt.Name+".")))
+	var previous []byte
+	var manifest generator.Manifest
+	manifestPath := outputPath + ".manifest"
+	if *onlyChanged {
+		manifest = generator.Manifest{}
+		// on a first generation there is nothing to reuse yet.
+		previous, _ = ioutil.ReadFile(outputPath)
+		if b, err := ioutil.ReadFile(manifestPath); err == nil {
+			if err := json.Unmarshal(b, &manifest); err != nil {
+				log.Fatalf("failed to read manifest %s: %v", manifestPath, err)
+			}
 		}
 	}
 
-	// avoid needing to import current pkg; there's probably a better way.
-	out = bytes.NewBuffer(bytes.ReplaceAll(out.Bytes(),
-		[]byte(topPkg.PkgPath+"."),
-		nil))
-
-	outputFile, err := os.Create(outputPath)
-	if err != nil {
-		log.Fatalf("os.Create: %v", err)
+	var description *generator.Description
+	if *specManifest != "" || *jsonSchema != "" {
+		description = &generator.Description{}
 	}
 
-	_, err = outputFile.Write(goFmt(out.Bytes()))
-	if err != nil {
-		log.Fatalf("failed to write file: %v", err)
+	var mode os.FileMode
+	if *fileMode != "" {
+		m, err := strconv.ParseUint(*fileMode, 8, 32)
+		if err != nil {
+			log.Fatalf("invalid -file-mode %q: %v", *fileMode, err)
+		}
+		mode = os.FileMode(m)
 	}
-}
 
-type StructDef struct {
-	OriginalStructName string
-	StructName         string
-	Struct             *types.Struct
-}
-
-func outputStructHCL2SpecBody(w io.Writer, s *types.Struct) {
-	fmt.Fprintf(w, "s := map[string]hcldec.Spec{\n")
-
-	for i := 0; i < s.NumFields(); i++ {
-		field, tag := s.Field(i), s.Tag(i)
-		st, _ := structtag.Parse(tag)
-		ctyTag, _ := st.Get("cty")
-		fmt.Fprintf(w, "	\"%s\": ", ctyTag.Name)
-		outputHCL2SpecField(w, ctyTag.Name, field.Type(), st)
-		fmt.Fprintln(w, `,`)
+	opts := generator.Options{
+		TypeNames:                names,
+		All:                      *all,
+		Implementing:             *implementing,
+		ExcludeTypes:             excluded,
+		Patterns:                 args,
+		BuildTags:                *buildTags,
+		Tests:                    *tests,
+		PackageName:              *packageName,
+		TrimPrefix:               *trimprefix,
+		CommandLine:              strings.Join(os.Args[1:], " "),
+		NoFallback:               *noFallback,
+		ToCtyValue:               *toCtyValue,
+		DecodeCtyValue:           *decodeCty,
+		EmptySlicesAsNull:        *emptyAsNull,
+		CaptureRanges:            *captureRanges,
+		CtyToFieldName:           *ctyToField,
+		Strict:                   *strict,
+		MaxDepth:                 *maxDepth,
+		List:                     *list,
+		IgnoreFields:             ignored,
+		FieldRenames:             renames,
+		EmitHCLTags:              *emitHCLTags,
+		EmitStringer:             *emitStringer,
+		Annotate:                 *annotate,
+		SquashEmbedded:           *squashEmbedded,
+		CollapseWrappers:         *collapse,
+		RequiredFromNonPointer:   *requiredFromNP,
+		NoPointerBasics:          *noPtrBasics,
+		RequiredFields:           required,
+		KeepZeroValueDistinction: *keepZero,
+		IncludeNested:            *includeNested,
+		IncludeUnexported:        *unexported,
+		LintSelfDefined:          *lintSelfDef,
+		OnlyChanged:              *onlyChanged,
+		Previous:                 previous,
+		Manifest:                 manifest,
+		Description:              description,
+		Header:                   string(header),
+		HeaderBeforeMarker:       *headerBefore,
 	}
 
-	fmt.Fprintln(w, `}`)
-	fmt.Fprintln(w, `return s`)
-}
-
-func outputHCL2SpecField(w io.Writer, accessor string, fieldType types.Type, tag *structtag.Tags) {
-	if m2h, err := tag.Get(""); err == nil && m2h.HasOption("self-defined") {
-		fmt.Fprintf(w, `(&%s{}).HCL2Spec()`, fieldType.String())
-		return
-	}
-	switch f := fieldType.(type) {
-	case *types.Pointer:
-		outputHCL2SpecField(w, accessor, f.Elem(), tag)
-	case *types.Basic:
-		fmt.Fprintf(w, `%#v`, &hcldec.AttrSpec{
-			Name:     accessor,
-			Type:     basicKindToCtyType(f.Kind()),
-			Required: false,
-		})
-	case *types.Map:
-		fmt.Fprintf(w, `%#v`, &hcldec.BlockAttrsSpec{
-			TypeName:    accessor,
-			ElementType: cty.String, // for now everything can be simplified to a map[string]string
-			Required:    false,
-		})
-	case *types.Slice:
-		elem := f.Elem()
-		if ptr, isPtr := elem.(*types.Pointer); isPtr {
-			elem = ptr.Elem()
-		}
-		switch elem := elem.(type) {
-		case *types.Basic:
-			fmt.Fprintf(w, `%#v`, &hcldec.AttrSpec{
-				Name:     accessor,
-				Type:     cty.List(basicKindToCtyType(elem.Kind())),
-				Required: false,
-			})
-		case *types.Named:
-			b := bytes.NewBuffer(nil)
-			outputHCL2SpecField(b, accessor, elem, tag)
-			fmt.Fprintf(w, `&hcldec.BlockListSpec{TypeName: "%s", Nested: %s}`, accessor, b.String())
-		case *types.Slice:
-			b := bytes.NewBuffer(nil)
-			outputHCL2SpecField(b, accessor, elem.Underlying(), tag)
-			fmt.Fprintf(w, `&hcldec.BlockListSpec{TypeName: "%s", Nested: %s}`, accessor, b.String())
-		default:
-			outputHCL2SpecField(w, accessor, elem.Underlying(), tag)
+	if *concurrent > 0 {
+		codes, err := generator.GeneratePackages(opts, *concurrent)
+		if err != nil {
+			log.Fatalf("error: %v", err)
 		}
-	case *types.Named:
-		underlyingType := f.Underlying()
-		switch underlyingType.(type) {
-		case *types.Struct:
-			fmt.Fprintf(w, `&hcldec.BlockSpec{TypeName: "%s",`+
-				` Nested: hcldec.ObjectSpec((*%s)(nil).HCL2Spec())}`, accessor, f.String())
-		default:
-			outputHCL2SpecField(w, f.String(), underlyingType, tag)
+		for _, code := range codes {
+			if err := writeOutput(filepath.Join(code.Dir, name), code.Code, mode); err != nil {
+				log.Fatalf("failed to write file: %v", err)
+			}
 		}
-	case *types.Struct:
-		fmt.Fprintf(w, `&hcldec.BlockObjectSpec{TypeName: "%s",`+
-			` Nested: hcldec.ObjectSpec((*%s)(nil).HCL2Spec())}`, accessor, fieldType.String())
-	default:
-		fmt.Fprintf(w, `%#v`, &hcldec.AttrSpec{
-			Name:     accessor,
-			Type:     basicKindToCtyType(types.Bool),
-			Required: false,
-		})
-		fmt.Fprintf(w, `/* TODO(azr): could not find type */`)
-	}
-}
-
-func basicKindToCtyType(kind types.BasicKind) cty.Type {
-	switch kind {
-	case types.Bool:
-		return cty.Bool
-	case types.String:
-		return cty.String
-	case types.Int, types.Int8, types.Int16, types.Int32, types.Int64,
-		types.Uint, types.Uint8, types.Uint16, types.Uint32, types.Uint64,
-		types.Float32, types.Float64,
-		types.Complex64, types.Complex128:
-		return cty.Number
-	case types.Invalid:
-		return cty.String // TODO(azr): fix that beforehand ?
-	default:
-		log.Printf("Un handled basic kind: %d", kind)
-		return cty.String
+		return
 	}
-}
 
-func outputStructFields(w io.Writer, s *types.Struct) {
-	for i := 0; i < s.NumFields(); i++ {
-		field, tag := s.Field(i), s.Tag(i)
-		fmt.Fprintf(w, "	%s `%s`\n", strings.Replace(field.String(), "field ", "", 1), tag)
+	out, err := generator.Generate(opts)
+	if err != nil {
+		log.Fatalf("error: %v", err)
 	}
-}
-
-type NamePath struct {
-	Name, Path string
-}
 
-func outputImports(w io.Writer, imports map[NamePath]*types.Package) {
-	if len(imports) == 0 {
+	if *list {
+		os.Stdout.Write(out)
 		return
 	}
-	// naive implementation
-	pkgs := []NamePath{}
-	for k := range imports {
-		pkgs = append(pkgs, k)
-	}
-	sort.Slice(pkgs, func(i int, j int) bool {
-		return pkgs[i].Path < pkgs[j].Path
-	})
 
-	fmt.Fprint(w, "import (\n")
-	for _, pkg := range pkgs {
-		if pkg.Name == pkg.Path || strings.HasSuffix(pkg.Path, "/"+pkg.Name) {
-			fmt.Fprintf(w, "	\"%s\"\n", pkg.Path)
-		} else {
-			fmt.Fprintf(w, "	%s \"%s\"\n", pkg.Name, pkg.Path)
-		}
+	if err := writeOutput(outputPath, out, mode); err != nil {
+		log.Fatalf("failed to write file: %v", err)
 	}
-	fmt.Fprint(w, ")\n")
-}
 
-func getUsedImports(s *types.Struct) map[NamePath]*types.Package {
-	res := map[NamePath]*types.Package{}
-	for i := 0; i < s.NumFields(); i++ {
-		fieldType := s.Field(i).Type()
-		if p, ok := fieldType.(*types.Pointer); ok {
-			fieldType = p.Elem()
+	if *specManifest != "" {
+		b, err := json.MarshalIndent(description, "", "  ")
+		if err != nil {
+			log.Fatalf("failed to encode spec manifest: %v", err)
 		}
-		if p, ok := fieldType.(*types.Slice); ok {
-			fieldType = p.Elem()
+		if err := ioutil.WriteFile(*specManifest, b, 0644); err != nil {
+			log.Fatalf("failed to write spec manifest: %v", err)
 		}
-		namedType, ok := fieldType.(*types.Named)
-		if !ok {
-			continue
-		}
-		pkg := namedType.Obj().Pkg()
-		res[NamePath{pkg.Name(), pkg.Path()}] = pkg
 	}
-	return res
-}
 
-func addCtyTagToStruct(s *types.Struct) *types.Struct {
-	vars, tags := structFields(s)
-	for i := range tags {
-		field, tag := vars[i], tags[i]
-		ctyAccessor := ToSnakeCase(field.Name())
-		st, err := structtag.Parse(tag)
-		if err == nil {
-			if ms, err := st.Get("mapstructure"); err == nil && ms.Name != "" {
-				ctyAccessor = ms.Name
-			}
+	if *jsonSchema != "" {
+		// the schema of the -all types only has definitions.
+		root := ""
+		if len(names) > 0 {
+			root = names[0]
 		}
-		st.Set(&structtag.Tag{Key: "cty", Name: ctyAccessor})
-		// st.Set(&structtag.Tag{Key: "hcl", Name: ctyAccessor, Options: []string{"optional"}})
-		tags[i] = st.String()
-	}
-	return types.NewStruct(uniqueTags("cty", vars, tags))
-}
-
-func uniqueTags(tagName string, fields []*types.Var, tags []string) ([]*types.Var, []string) {
-	outVars := []*types.Var{}
-	outTags := []string{}
-	uniqueTags := map[string]bool{}
-	for i := range fields {
-		field, tag := fields[i], tags[i]
-		structtag, _ := structtag.Parse(tag)
-		h, err := structtag.Get(tagName)
-		if err == nil {
-			if uniqueTags[h.Name] {
-				log.Printf("skipping field %s ( duplicate `%s` %s tag  )", field.Name(), h.Name, tagName)
-				continue
-			}
-			uniqueTags[h.Name] = true
-		}
-		outVars = append(outVars, field)
-		outTags = append(outTags, tag)
-	}
-	return outVars, outTags
-}
-
-// getMapstructureSquashedStruct will return the same struct but embedded
-// fields with a `mapstructure:",squash"` tag will be un-nested.
-func getMapstructureSquashedStruct(topPkg *types.Package, utStruct *types.Struct) *types.Struct {
-	res := &types.Struct{}
-	for i := 0; i < utStruct.NumFields(); i++ {
-		field, tag := utStruct.Field(i), utStruct.Tag(i)
-		if !field.Exported() {
-			continue
+		b, err := json.MarshalIndent(description.JSONSchema(root), "", "  ")
+		if err != nil {
+			log.Fatalf("failed to encode JSON Schema: %v", err)
 		}
-		if _, ok := field.Type().(*types.Signature); ok {
-			continue // ignore funcs
+		if err := ioutil.WriteFile(*jsonSchema, b, 0644); err != nil {
+			log.Fatalf("failed to write JSON Schema: %v", err)
 		}
-		structtag, _ := structtag.Parse(tag)
-		if ms, err := structtag.Get("mapstructure"); err != nil {
-			//no mapstructure tag
-		} else if ms.HasOption("squash") {
-			ot := field.Type()
-			uot := ot.Underlying()
-			utStruct, utOk := uot.(*types.Struct)
-			if !utOk {
-				continue
-			}
+	}
 
-			res = squashStructs(res, getMapstructureSquashedStruct(topPkg, utStruct))
-			continue
-		}
-		if field.Pkg() != topPkg {
-			field = types.NewField(field.Pos(), topPkg, field.Name(), field.Type(), field.Embedded())
-		}
-		if p, isPointer := field.Type().(*types.Pointer); isPointer {
-			// in order to make the following switch simpler we 'unwrap' this
-			// pointer all structs are going to be made pointers anyways.
-			field = types.NewField(field.Pos(), field.Pkg(), field.Name(), p.Elem(), field.Embedded())
+	if *onlyChanged {
+		b, err := json.MarshalIndent(manifest, "", "  ")
+		if err != nil {
+			log.Fatalf("failed to encode manifest: %v", err)
 		}
-		switch f := field.Type().(type) {
-		case *types.Named:
-			switch f.String() {
-			case "time.Duration":
-				field = types.NewField(field.Pos(), field.Pkg(), field.Name(), types.NewPointer(types.Typ[types.String]), field.Embedded())
-			case "github.com/hashicorp/packer/helper/config.Trilean": // TODO(azr): unhack this situation
-				field = types.NewField(field.Pos(), field.Pkg(), field.Name(), types.NewPointer(types.Typ[types.Bool]), field.Embedded())
-			case "github.com/hashicorp/packer/provisioner/powershell.ExecutionPolicy": // TODO(azr): unhack this situation
-				field = types.NewField(field.Pos(), field.Pkg(), field.Name(), types.NewPointer(types.Typ[types.String]), field.Embedded())
-			}
-			if str, isStruct := f.Underlying().(*types.Struct); isStruct {
-				obj := flattenNamed(f, str)
-				field = types.NewField(field.Pos(), field.Pkg(), field.Name(), obj, field.Embedded())
-				field = makePointer(field)
-			}
-			if slice, isSlice := f.Underlying().(*types.Slice); isSlice {
-				if f, fNamed := slice.Elem().(*types.Named); fNamed {
-					if str, isStruct := f.Underlying().(*types.Struct); isStruct {
-						// this is a slice of named structs; we want to change
-						// the struct ref to a 'FlatStruct'.
-						obj := flattenNamed(f, str)
-						slice := types.NewSlice(obj)
-						field = types.NewField(field.Pos(), field.Pkg(), field.Name(), slice, field.Embedded())
-					}
-				}
-			}
-		case *types.Slice:
-			if f, fNamed := f.Elem().(*types.Named); fNamed {
-				if str, isStruct := f.Underlying().(*types.Struct); isStruct {
-					obj := flattenNamed(f, str)
-					field = types.NewField(field.Pos(), field.Pkg(), field.Name(), types.NewSlice(obj), field.Embedded())
-				}
-			}
-		case *types.Basic:
-			// since everything is optional, everything must be a pointer
-			// non optional fields should be non pointers.
-			field = makePointer(field)
+		if err := ioutil.WriteFile(manifestPath, b, 0644); err != nil {
+			log.Fatalf("failed to write manifest: %v", err)
 		}
-		res = addFieldToStruct(res, field, tag)
 	}
-	return res
-}
-
-func flattenNamed(f *types.Named, underlying types.Type) *types.Named {
-	obj := f.Obj()
-	obj = types.NewTypeName(obj.Pos(), obj.Pkg(), "Flat"+obj.Name(), obj.Type())
-	return types.NewNamed(obj, underlying, nil)
-}
-
-func makePointer(field *types.Var) *types.Var {
-	return types.NewField(field.Pos(), field.Pkg(), field.Name(), types.NewPointer(field.Type()), field.Embedded())
 }
 
-func addFieldToStruct(s *types.Struct, field *types.Var, tag string) *types.Struct {
-	sf, st := structFields(s)
-	return types.NewStruct(uniqueFields(append(sf, field), append(st, tag)))
-}
-
-func squashStructs(a, b *types.Struct) *types.Struct {
-	va, ta := structFields(a)
-	vb, tb := structFields(b)
-	return types.NewStruct(uniqueFields(append(va, vb...), append(ta, tb...)))
-}
-
-func uniqueFields(fields []*types.Var, tags []string) ([]*types.Var, []string) {
-	outVars := []*types.Var{}
-	outTags := []string{}
-	fieldNames := map[string]bool{}
-	for i := range fields {
-		field, tag := fields[i], tags[i]
-		if fieldNames[field.Name()] {
-			log.Printf("skipping duplicate %s field", field.Name())
-			continue
-		}
-		fieldNames[field.Name()] = true
-		outVars = append(outVars, field)
-		outTags = append(outTags, tag)
+// outputName returns the name of the generated file, named after the file
+// go generate runs from, ex: config.hcl2spec.go for config.go, or after
+// typeName when there is none. The code generated from the test files goes
+// to a test file, ex: config.hcl2spec_test.go for config_test.go.
+func outputName(typeName, goFile string, test bool) string {
+	// GOFILE is a base name, but this makes sure that the file stays in the
+	// package directory whatever it is.
+	base := strings.TrimSuffix(filepath.Base(strings.TrimSpace(goFile)), ".go")
+	if test {
+		base = strings.TrimSuffix(base, "_test")
 	}
-	return outVars, outTags
-}
-
-func structFields(s *types.Struct) (vars []*types.Var, tags []string) {
-	for i := 0; i < s.NumFields(); i++ {
-		field, tag := s.Field(i), s.Tag(i)
-		vars = append(vars, field)
-		tags = append(tags, tag)
+	if base == "" || base == "." || base == string(filepath.Separator) {
+		base = strings.ToLower(typeName)
+	}
+	if test {
+		return base + ".hcl2spec_test.go"
 	}
-	return vars, tags
+	return base + ".hcl2spec.go"
 }
 
-var matchFirstCap = regexp.MustCompile("(.)([A-Z][a-z]+)")
-var matchAllCap = regexp.MustCompile("([a-z0-9])([A-Z])")
-
-func ToSnakeCase(str string) string {
-	snake := matchFirstCap.ReplaceAllString(str, "${1}_${2}")
-	snake = matchAllCap.ReplaceAllString(snake, "${1}_${2}")
-	return strings.ToLower(snake)
+// writeOutput writes b to path, creating its directory if needed. When mode
+// is set, the file is given exactly that mode, whatever the umask.
+func writeOutput(path string, b []byte, mode os.FileMode) error {
+	return writeAtomic(path, mode, func(w io.Writer) error {
+		_, err := w.Write(b)
+		return err
+	})
 }
 
-func goFmt(b []byte) []byte {
-	fb, err := format.Source(b)
+// writeAtomic writes the output of write to a temporary file next to path
+// then renames it to path, so that a failed write leaves the previous file
+// untouched rather than truncated, which would break the build.
+func writeAtomic(path string, mode os.FileMode, write func(io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	perm := mode
+	if perm == 0 {
+		perm = 0666
+	}
+	// in the same directory, a rename across file systems isn't atomic.
+	tmp := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && mode != 0 {
+		err = os.Chmod(tmp, mode)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
 	if err != nil {
-		log.Printf("formatting err: %v", err)
-		return b
+		os.Remove(tmp)
 	}
-	return fb
+	return err
 }
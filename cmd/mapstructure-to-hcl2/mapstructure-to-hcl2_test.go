@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mapstructure-to-hcl2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "a", "b", "config.hcl2spec.go")
+	if err := writeOutput(path, []byte("package a\n"), 0600); err != nil {
+		t.Fatalf("writeOutput: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("expected mode 0600, got %o", info.Mode().Perm())
+	}
+	if b, _ := ioutil.ReadFile(path); string(b) != "package a\n" {
+		t.Fatalf("unexpected content %q", b)
+	}
+}
+
+func TestOutputName(t *testing.T) {
+	for goFile, expected := range map[string]string{
+		"":                  "config.hcl2spec.go",
+		"  ":                "config.hcl2spec.go",
+		".go":               "config.hcl2spec.go",
+		"/":                 "config.hcl2spec.go",
+		"go":                "go.hcl2spec.go",
+		"config.go":         "config.hcl2spec.go",
+		"config.go.go":      "config.go.hcl2spec.go",
+		"config.tmpl":       "config.tmpl.hcl2spec.go",
+		"builder/config.go": "config.hcl2spec.go",
+	} {
+		if got := outputName("Config", goFile, false); got != expected {
+			t.Errorf("outputName(%q): expected %s, got %s", goFile, expected, got)
+		}
+	}
+	for goFile, expected := range map[string]string{
+		"":               "config.hcl2spec_test.go",
+		"_test.go":       "config.hcl2spec_test.go",
+		"config.go":      "config.hcl2spec_test.go",
+		"config_test.go": "config.hcl2spec_test.go",
+	} {
+		if got := outputName("Config", goFile, true); got != expected {
+			t.Errorf("outputName(%q, test): expected %s, got %s", goFile, expected, got)
+		}
+	}
+}
+
+func TestWriteOutputFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mapstructure-to-hcl2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.hcl2spec.go")
+	if err := writeOutput(path, []byte("package a\n"), 0); err != nil {
+		t.Fatalf("writeOutput: %v", err)
+	}
+	err = writeAtomic(path, 0, func(w io.Writer) error {
+		w.Write([]byte("package"))
+		return errors.New("disk full")
+	})
+	if err == nil || err.Error() != "disk full" {
+		t.Fatalf("expected the write error, got %v", err)
+	}
+	if b, _ := ioutil.ReadFile(path); string(b) != "package a\n" {
+		t.Fatalf("expected the previous file to be untouched, got %q", b)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Fatalf("expected the temporary file to be removed, got %d files", len(files))
+	}
+}
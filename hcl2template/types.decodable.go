@@ -2,9 +2,15 @@ package hcl2template
 
 import (
 	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer/helper/config"
 	"github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/gocty"
 )
@@ -17,6 +23,23 @@ type SelfSpecified interface {
 	HCL2Spec() map[string]hcldec.Spec
 }
 
+// Validator is implemented by the Flat structs that have bounded fields.
+type Validator interface {
+	Validate() hcl.Diagnostics
+}
+
+// CtyDecoder is implemented by the Flat structs generated with
+// -keep-zero-value-distinction, whose Nullable fields gocty can't set.
+type CtyDecoder interface {
+	FromCtyValue(val cty.Value) error
+}
+
+// RangeCapturer is implemented by the Flat structs generated with
+// -capture-ranges.
+type RangeCapturer interface {
+	CaptureRanges(body hcl.Body)
+}
+
 func decodeDecodable(block *hcl.Block, ctx *hcl.EvalContext, dec Decodable) (interface{}, hcl.Diagnostics) {
 	var diags hcl.Diagnostics
 
@@ -34,8 +57,23 @@ func decodeDecodable(block *hcl.Block, ctx *hcl.EvalContext, dec Decodable) (int
 	}
 	val, moreDiags := hcldec.Decode(block.Body, spec, ctx)
 	diags = append(diags, moreDiags...)
+	if checkDiags := checkAttributes(block, val, flatCfg); checkDiags.HasErrors() {
+		// gocty would also fail to set the numbers out of bounds, but with
+		// a less helpful error.
+		return flatCfg, append(diags, checkDiags...)
+	}
+	val, moreDiags = decodeBase64Attributes(block, val, flatCfg)
+	diags = append(diags, moreDiags...)
+	if moreDiags.HasErrors() {
+		return flatCfg, diags
+	}
 
-	err := gocty.FromCtyValue(val, flatCfg)
+	var err error
+	if cd, ok := flatCfg.(CtyDecoder); ok {
+		err = cd.FromCtyValue(val)
+	} else {
+		err = gocty.FromCtyValue(val, flatCfg)
+	}
 	if err != nil {
 		switch err := err.(type) {
 		case cty.PathError:
@@ -52,5 +90,139 @@ func decodeDecodable(block *hcl.Block, ctx *hcl.EvalContext, dec Decodable) (int
 			})
 		}
 	}
+	if rc, ok := flatCfg.(RangeCapturer); ok {
+		rc.CaptureRanges(block.Body)
+	}
+	if v, ok := flatCfg.(Validator); ok && !diags.HasErrors() {
+		for _, diag := range v.Validate() {
+			if diag.Subject == nil {
+				diag.Subject = &block.DefRange
+			}
+			diags = append(diags, diag)
+		}
+	}
 	return flatCfg, diags
 }
+
+// checkAttributes makes sure that the values set for the fields of flatCfg,
+// including the ones of its nested blocks, fit their tags:
+//   - `hcl2bounds:"min,max"`: numbers in the range, an empty min or max is
+//     not checked.
+//   - `hcl2encoding:"complex"`: strings that can be scanned into a complex,
+//     ex: "(1+2i)".
+//   - `hcl2encoding:"rfc3339"`: strings, or lists of strings, that are RFC
+//     3339 times, ex: "2006-01-02T15:04:05Z".
+//   - `hcl2encoding:"rune"`: strings of a single character, ex: "a".
+func checkAttributes(block *hcl.Block, val cty.Value, flatCfg interface{}) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	config.WalkAttributes(val, flatCfg, func(path cty.Path, field reflect.StructField, v cty.Value) (cty.Value, error) {
+		if v.IsNull() || !v.IsKnown() {
+			return v, nil
+		}
+		name := attributePath(path)
+		invalid := func(detail string, args ...interface{}) {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf("Invalid value for %s", name),
+				Subject:  &block.DefRange,
+				Detail:   fmt.Sprintf(detail, args...),
+			})
+		}
+		if bounds, found := field.Tag.Lookup("hcl2bounds"); found && v.Type().Equals(cty.Number) {
+			n := v.AsBigFloat()
+			min, max := splitBounds(bounds)
+			if (min != nil && n.Cmp(min) < 0) || (max != nil && n.Cmp(max) > 0) {
+				invalid("%s is out of the [%s] range", n.Text('f', -1), bounds)
+			}
+		}
+		encoding := field.Tag.Get("hcl2encoding")
+		var values []cty.Value
+		switch {
+		case v.Type().Equals(cty.String):
+			values = []cty.Value{v}
+		case encoding == "rfc3339" && v.Type().IsListType() && v.Type().ElementType().Equals(cty.String):
+			values = v.AsValueSlice()
+		}
+		for _, v := range values {
+			if v.IsNull() || !v.IsKnown() {
+				continue
+			}
+			s := v.AsString()
+			switch encoding {
+			case "complex":
+				var c complex128
+				if _, err := fmt.Sscan(s, &c); err != nil {
+					invalid("%s must be a complex number like \"(1+2i)\": %v", name, err)
+				}
+			case "rfc3339":
+				if _, err := time.Parse(time.RFC3339, s); err != nil {
+					invalid("%s must be a RFC 3339 time like \"2006-01-02T15:04:05Z\": %v", name, err)
+				}
+			case "rune":
+				if utf8.RuneCountInString(s) != 1 {
+					invalid("%s must be a single character, got %q", name, s)
+				}
+			}
+		}
+		return v, nil
+	})
+	return diags
+}
+
+// decodeBase64Attributes decodes the strings set for the fields of flatCfg
+// that have a `hcl2encoding:"base64"` tag, including the ones of its nested
+// blocks, into lists of bytes, so that gocty can set them in their []byte
+// fields.
+func decodeBase64Attributes(block *hcl.Block, val cty.Value, flatCfg interface{}) (cty.Value, hcl.Diagnostics) {
+	val, err := config.DecodeBase64Attributes(val, flatCfg)
+	if err == nil {
+		return val, nil
+	}
+	var name string
+	if err, ok := err.(cty.PathError); ok {
+		name = attributePath(err.Path)
+	}
+	return val, hcl.Diagnostics{{
+		Severity: hcl.DiagError,
+		Summary:  fmt.Sprintf("Invalid value for %s", name),
+		Subject:  &block.DefRange,
+		Detail:   fmt.Sprintf("%s %v", name, err),
+	}}
+}
+
+// attributePath returns path like in HCL, ex: disk[0].size.
+func attributePath(path cty.Path) string {
+	var b strings.Builder
+	for _, step := range path {
+		switch step := step.(type) {
+		case cty.GetAttrStep:
+			if b.Len() > 0 {
+				b.WriteByte('.')
+			}
+			b.WriteString(step.Name)
+		case cty.IndexStep:
+			if step.Key.Type().Equals(cty.Number) {
+				fmt.Fprintf(&b, "[%s]", step.Key.AsBigFloat().Text('f', -1))
+			} else {
+				fmt.Fprintf(&b, "[%q]", step.Key.AsString())
+			}
+		}
+	}
+	return b.String()
+}
+
+func splitBounds(bounds string) (min, max *big.Float) {
+	parts := strings.SplitN(bounds, ",", 2)
+	parse := func(s string) *big.Float {
+		f, _, err := big.ParseFloat(strings.TrimSpace(s), 10, 512, big.ToNearestEven)
+		if err != nil {
+			return nil
+		}
+		return f
+	}
+	min = parse(parts[0])
+	if len(parts) == 2 {
+		max = parse(parts[1])
+	}
+	return min, max
+}
@@ -0,0 +1,233 @@
+package hcl2template
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+type testConfig struct{}
+
+func (*testConfig) FlatMapstructure() interface{} { return new(flatTestConfig) }
+
+// flatTestConfig has a field of each of the kinds mapstructure-to-hcl2
+// generates, along with the method of -capture-ranges.
+type flatTestConfig struct {
+	Tags         []string             `mapstructure:"tags" cty:"tags"`
+	PlaybookFile *string              `mapstructure:"playbook_file" cty:"playbook_file"`
+	Expiry       *string              `mapstructure:"expiry" cty:"expiry" hcl2encoding:"rfc3339"`
+	Stamps       []string             `mapstructure:"stamps" cty:"stamps" hcl2encoding:"rfc3339"`
+	Separator    *string              `mapstructure:"separator" cty:"separator" hcl2encoding:"rune"`
+	Offset       *int32               `mapstructure:"offset" cty:"offset"`
+	Data         []byte               `mapstructure:"data" cty:"data" hcl2encoding:"base64"`
+	Port         *int                 `mapstructure:"port" cty:"port" hcl2bounds:"1,65535"`
+	Impedance    *string              `mapstructure:"impedance" cty:"impedance" hcl2encoding:"complex"`
+	Disk         *flatTestDisk        `mapstructure:"disk" cty:"disk"`
+	Disks        []flatTestDisk       `mapstructure:"disks" cty:"disks"`
+	HCL2Ranges   map[string]hcl.Range `mapstructure:"-"`
+}
+
+// flatTestDisk is a nested block of flatTestConfig.
+type flatTestDisk struct {
+	Data      []byte  `mapstructure:"data" cty:"data" hcl2encoding:"base64"`
+	Size      *int    `mapstructure:"size" cty:"size" hcl2bounds:"1,"`
+	Impedance *string `mapstructure:"impedance" cty:"impedance" hcl2encoding:"complex"`
+}
+
+func (*flatTestDisk) HCL2Spec() map[string]hcldec.Spec {
+	return map[string]hcldec.Spec{
+		"data":      &hcldec.AttrSpec{Name: "data", Type: cty.String, Required: false},
+		"size":      &hcldec.AttrSpec{Name: "size", Type: cty.Number, Required: false},
+		"impedance": &hcldec.AttrSpec{Name: "impedance", Type: cty.String, Required: false},
+	}
+}
+
+func (*flatTestConfig) HCL2Spec() map[string]hcldec.Spec {
+	return map[string]hcldec.Spec{
+		"tags":          &hcldec.AttrSpec{Name: "tags", Type: cty.List(cty.String), Required: false},
+		"playbook_file": &hcldec.AttrSpec{Name: "playbook_file", Type: cty.String, Required: false},
+		"expiry":        &hcldec.AttrSpec{Name: "expiry", Type: cty.String, Required: false},
+		"stamps":        &hcldec.AttrSpec{Name: "stamps", Type: cty.List(cty.String), Required: false},
+		"separator":     &hcldec.AttrSpec{Name: "separator", Type: cty.String, Required: false},
+		"offset":        &hcldec.AttrSpec{Name: "offset", Type: cty.Number, Required: false},
+		"data":          &hcldec.AttrSpec{Name: "data", Type: cty.String, Required: false},
+		"port":          &hcldec.AttrSpec{Name: "port", Type: cty.Number, Required: false},
+		"impedance":     &hcldec.AttrSpec{Name: "impedance", Type: cty.String, Required: false},
+		"disk":          &hcldec.BlockSpec{TypeName: "disk", Nested: hcldec.ObjectSpec((&flatTestDisk{}).HCL2Spec())},
+		"disks":         &hcldec.BlockListSpec{TypeName: "disks", Nested: hcldec.ObjectSpec((&flatTestDisk{}).HCL2Spec())},
+	}
+}
+
+func (c *flatTestConfig) CaptureRanges(body hcl.Body) {
+	content, _, _ := body.PartialContent(hcldec.ImpliedSchema(hcldec.ObjectSpec(c.HCL2Spec())))
+	c.HCL2Ranges = make(map[string]hcl.Range, len(content.Attributes))
+	for name, attr := range content.Attributes {
+		c.HCL2Ranges[name] = attr.Range
+	}
+}
+
+// decodeTestBlock decodes the first block of src as a testConfig.
+func decodeTestBlock(t *testing.T, src string) (*flatTestConfig, hcl.Diagnostics) {
+	t.Helper()
+	f, diags := hclsyntax.ParseConfig([]byte(src), "test.pkr.hcl", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+	block := f.Body.(*hclsyntax.Body).Blocks[0].AsHCLBlock()
+	decoded, diags := decodeDecodable(block, nil, &testConfig{})
+	return decoded.(*flatTestConfig), diags
+}
+
+func TestDecodeDecodable(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		// wantErr starts the Detail of the only expected diagnostic.
+		wantErr string
+		check   func(t *testing.T, c *flatTestConfig)
+	}{
+		{"omitted list", `source "x" {}`, "", func(t *testing.T, c *flatTestConfig) {
+			if c.Tags != nil {
+				t.Fatalf("expected a nil slice, got %#v", c.Tags)
+			}
+		}},
+		{"empty list", `source "x" { tags = [] }`, "", func(t *testing.T, c *flatTestConfig) {
+			if c.Tags == nil || len(c.Tags) != 0 {
+				t.Fatalf("expected an empty slice, got %#v", c.Tags)
+			}
+		}},
+		{"list", `source "x" { tags = ["a"] }`, "", func(t *testing.T, c *flatTestConfig) {
+			if len(c.Tags) != 1 {
+				t.Fatalf("expected 1 tag, got %#v", c.Tags)
+			}
+		}},
+
+		// hcldec.Decode reads the body with body.Content, which errors on
+		// the attributes that are not in the spec: this guards against a
+		// decode that would silently ignore them.
+		{"unknown attribute", "provisioner \"ansible\" {\n  playbok_file = \"x\"\n}",
+			`An argument named "playbok_file" is not expected here. Did you mean "playbook_file"?`, nil},
+
+		{"captured ranges", "source \"x\" {\n  playbook_file = \"a\"\n}", "", func(t *testing.T, c *flatTestConfig) {
+			rng, found := c.HCL2Ranges["playbook_file"]
+			if !found {
+				t.Fatal("expected the range of playbook_file to be captured")
+			}
+			if got := rng.String(); got != "test.pkr.hcl:2,3-22" {
+				t.Fatalf("unexpected range %s", got)
+			}
+		}},
+
+		{"rfc3339", `source "x" {
+  expiry = "2006-01-02T15:04:05Z"
+  stamps = ["2006-01-02T15:04:05+07:00"]
+}`, "", nil},
+		{"invalid rfc3339", `source "x" { expiry = "tomorrow" }`,
+			`expiry must be a RFC 3339 time like "2006-01-02T15:04:05Z": `, nil},
+		{"invalid rfc3339 list", `source "x" { stamps = ["2006-01-02T15:04:05Z", "2006-01-02"] }`,
+			`stamps must be a RFC 3339 time like "2006-01-02T15:04:05Z": `, nil},
+
+		{"rune", `source "x" {
+  separator = "é"
+  offset    = 42
+}`, "", func(t *testing.T, c *flatTestConfig) {
+			if *c.Separator != "é" || *c.Offset != 42 {
+				t.Fatalf("unexpected separator %q and offset %d", *c.Separator, *c.Offset)
+			}
+		}},
+		{"base64", `source "x" { data = "aGk=" }`, "", func(t *testing.T, c *flatTestConfig) {
+			if string(c.Data) != "hi" {
+				t.Fatalf("expected hi, got %q", c.Data)
+			}
+		}},
+		{"invalid base64", `source "x" { data = "hi!" }`, "data must be base64 encoded: ", nil},
+		{"nested base64", `source "x" {
+  disk {
+    data = "aGk="
+  }
+  disks {
+    data = "eW8="
+  }
+  disks {}
+}`, "", func(t *testing.T, c *flatTestConfig) {
+			if c.Disk == nil || string(c.Disk.Data) != "hi" {
+				t.Fatalf("expected hi in the disk block, got %#v", c.Disk)
+			}
+			if len(c.Disks) != 2 || string(c.Disks[0].Data) != "yo" || c.Disks[1].Data != nil {
+				t.Fatalf("expected yo then nothing in the disks blocks, got %#v", c.Disks)
+			}
+		}},
+		{"invalid nested base64", `source "x" {
+  disks {}
+  disks {
+    data = "hi!"
+  }
+}`, "disks[1].data must be base64 encoded: ", nil},
+
+		{"bounds", `source "x" {
+  port = 65535
+  disk {
+    size = 1
+  }
+}`, "", func(t *testing.T, c *flatTestConfig) {
+			if *c.Port != 65535 || *c.Disk.Size != 1 {
+				t.Fatalf("unexpected port %d and size %d", *c.Port, *c.Disk.Size)
+			}
+		}},
+		{"under the min", `source "x" { port = 0 }`, "0 is out of the [1,65535] range", nil},
+		{"over the max", `source "x" { port = 65536 }`, "65536 is out of the [1,65535] range", nil},
+		{"nested under the min", `source "x" {
+  disks {
+    size = 0
+  }
+}`, "0 is out of the [1,] range", nil},
+
+		{"complex", `source "x" {
+  impedance = "(1+2i)"
+  disks {
+    impedance = "(3-4i)"
+  }
+}`, "", func(t *testing.T, c *flatTestConfig) {
+			if *c.Impedance != "(1+2i)" || *c.Disks[0].Impedance != "(3-4i)" {
+				t.Fatalf("unexpected impedances %q and %q", *c.Impedance, *c.Disks[0].Impedance)
+			}
+		}},
+		{"invalid complex", `source "x" { impedance = "1+" }`, `impedance must be a complex number like "(1+2i)": `, nil},
+		{"invalid nested complex", `source "x" {
+  disk {
+    impedance = "i"
+  }
+}`, `disk.impedance must be a complex number like "(1+2i)": `, nil},
+
+		{"empty rune", `source "x" { separator = "" }`, `separator must be a single character, got ""`, nil},
+		{"several runes", `source "x" { separator = "ab" }`, `separator must be a single character, got "ab"`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, diags := decodeTestBlock(t, tt.src)
+			if tt.wantErr == "" {
+				if diags.HasErrors() {
+					t.Fatal(diags)
+				}
+			} else if len(diags) != 1 || !strings.HasPrefix(diags[0].Detail, tt.wantErr) {
+				t.Fatalf("expected the error %q, got %v", tt.wantErr, diags)
+			}
+			if tt.check != nil {
+				tt.check(t, c)
+			}
+		})
+	}
+}
+
+// TestDecodeDecodable_unknownAttributeRange checks that the error hcldec
+// returns on an unknown attribute points at it.
+func TestDecodeDecodable_unknownAttributeRange(t *testing.T) {
+	_, diags := decodeTestBlock(t, "provisioner \"ansible\" {\n  playbok_file = \"x\"\n}")
+	if len(diags) != 1 || diags[0].Subject.Start.Line != 2 {
+		t.Fatalf("expected one diagnostic pointing at line 2, got %v", diags)
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/packer/template/interpolate"
@@ -32,6 +35,9 @@ var DefaultDecodeHookFuncs = []mapstructure.DecodeHookFunc{
 	stringToTrilean,
 	mapstructure.StringToSliceHookFunc(","),
 	mapstructure.StringToTimeDurationHookFunc(),
+	stringToRune,
+	stringToComplex,
+	stringToTimeHookFunc(time.RFC3339),
 }
 
 // Decode decodes the configuration into the target and optionally
@@ -85,11 +91,23 @@ func Decode(target interface{}, config *DecodeOpts, raws ...interface{}) error {
 	if err != nil {
 		return err
 	}
-	for _, raw := range raws {
+	// mapstructure can't decode complex numbers, they are set once the rest
+	// is decoded.
+	setComplexes := make([]func(reflect.Value, mapstructure.DecodeHookFunc) error, len(raws))
+	for i, raw := range raws {
+		raw, setComplexes[i] = takeComplexFields(raw, reflect.TypeOf(target))
 		if err := decoder.Decode(raw); err != nil {
 			return err
 		}
 	}
+	for _, setComplex := range setComplexes {
+		if setComplex == nil {
+			continue
+		}
+		if err := setComplex(reflect.ValueOf(target), mapstructure.ComposeDecodeHookFunc(decodeHookFuncs...)); err != nil {
+			return err
+		}
+	}
 
 	// Set the metadata if it is set
 	if config.Metadata != nil {
@@ -182,3 +200,215 @@ func stringToTrilean(f reflect.Type, t reflect.Type, v interface{}) (interface{}
 	}
 	return v, nil
 }
+
+func stringToRune(f reflect.Kind, t reflect.Kind, v interface{}) (interface{}, error) {
+	// The HCL2 Flat structs set rune fields as one character strings, ex:
+	// "a". reflect can't tell a rune from an int32 though, so a string
+	// holding an integer is left to the weakly typed decoding, ex: "42" for
+	// an int32.
+	if f != reflect.String || t != reflect.Int32 {
+		return v, nil
+	}
+	s := reflect.ValueOf(v).String()
+	if _, err := strconv.ParseInt(s, 0, 32); err == nil || utf8.RuneCountInString(s) != 1 {
+		return v, nil
+	}
+	r, _ := utf8.DecodeRuneInString(s)
+	return r, nil
+}
+
+func stringToComplex(f reflect.Kind, t reflect.Kind, v interface{}) (interface{}, error) {
+	// The HCL2 Flat structs set complex fields as strings, ex: "(1+2i)".
+	if f != reflect.String || t != reflect.Complex64 && t != reflect.Complex128 {
+		return v, nil
+	}
+	bitSize := 128
+	if t == reflect.Complex64 {
+		bitSize = 64
+	}
+	c, err := strconv.ParseComplex(reflect.ValueOf(v).String(), bitSize)
+	if err != nil {
+		return v, err
+	}
+	return c, nil
+}
+
+// stringToTimeHookFunc returns a hook decoding strings into time.Time values
+// with layout, like mapstructure.StringToTimeHookFunc which the vendored
+// mapstructure lacks. The HCL2 Flat structs set time.Time fields as RFC 3339
+// strings.
+func stringToTimeHookFunc(layout string) mapstructure.DecodeHookFuncType {
+	return func(f reflect.Type, t reflect.Type, v interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String || t != reflect.TypeOf(time.Time{}) {
+			return v, nil
+		}
+		return time.Parse(layout, reflect.ValueOf(v).String())
+	}
+}
+
+// takeComplexFields returns raw, decoded into a t, without the values of the
+// complex fields of t, which mapstructure fails on, along with the func
+// setting them on the decoded t with the decode hooks. The func is nil when
+// raw sets no complex field.
+func takeComplexFields(raw interface{}, t reflect.Type) (interface{}, func(reflect.Value, mapstructure.DecodeHookFunc) error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	rawVal := reflect.Indirect(reflect.ValueOf(raw))
+	switch {
+	case !hasComplexFields(t, map[reflect.Type]bool{}):
+		return raw, nil
+	case (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && rawVal.Kind() == reflect.Slice:
+		elems := make([]interface{}, rawVal.Len())
+		var setters []func(reflect.Value, mapstructure.DecodeHookFunc) error
+		for i := range elems {
+			elem, set := takeComplexFields(rawVal.Index(i).Interface(), t.Elem())
+			elems[i] = elem
+			if set != nil {
+				i := i
+				setters = append(setters, func(v reflect.Value, hook mapstructure.DecodeHookFunc) error {
+					if v.Kind() == reflect.Ptr && v.IsNil() || i >= reflect.Indirect(v).Len() {
+						return nil
+					}
+					return set(reflect.Indirect(v).Index(i), hook)
+				})
+			}
+		}
+		return elems, composeSetters(setters)
+	case t.Kind() != reflect.Struct || rawVal.Kind() != reflect.Map:
+		return raw, nil
+	}
+
+	m := make(map[string]interface{}, rawVal.Len())
+	for _, k := range rawVal.MapKeys() {
+		m[fmt.Sprint(k.Interface())] = rawVal.MapIndex(k).Interface()
+	}
+	var setters []func(reflect.Value, mapstructure.DecodeHookFunc) error
+	for key, value := range m {
+		field, found := mapstructureField(t, key)
+		if !found {
+			continue
+		}
+		ft := field.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() != reflect.Complex64 && ft.Kind() != reflect.Complex128 {
+			var set func(reflect.Value, mapstructure.DecodeHookFunc) error
+			if m[key], set = takeComplexFields(value, field.Type); set != nil {
+				index := field.Index
+				setters = append(setters, func(v reflect.Value, hook mapstructure.DecodeHookFunc) error {
+					fv := reflect.Indirect(v).FieldByIndex(index)
+					if fv.Kind() == reflect.Ptr && fv.IsNil() {
+						return nil
+					}
+					return set(fv, hook)
+				})
+			}
+			continue
+		}
+		delete(m, key)
+		key, value, index := key, value, field.Index
+		setters = append(setters, func(v reflect.Value, hook mapstructure.DecodeHookFunc) error {
+			fv := reflect.Indirect(v).FieldByIndex(index)
+			for fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					fv.Set(reflect.New(fv.Type().Elem()))
+				}
+				fv = fv.Elem()
+			}
+			data, err := mapstructure.DecodeHookExec(hook, reflect.TypeOf(value), fv.Type(), value)
+			if err != nil {
+				return fmt.Errorf("error decoding '%s': %s", key, err)
+			}
+			dataVal := reflect.ValueOf(data)
+			switch dataVal.Kind() {
+			case reflect.Complex64, reflect.Complex128:
+				fv.SetComplex(dataVal.Complex())
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				fv.SetComplex(complex(float64(dataVal.Int()), 0))
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				fv.SetComplex(complex(float64(dataVal.Uint()), 0))
+			case reflect.Float32, reflect.Float64:
+				fv.SetComplex(complex(dataVal.Float(), 0))
+			default:
+				return fmt.Errorf("'%s' expected type '%s', got unconvertible type '%T'", key, fv.Type(), value)
+			}
+			return nil
+		})
+	}
+	return m, composeSetters(setters)
+}
+
+// composeSetters returns a func calling each of setters, or nil when there
+// are none.
+func composeSetters(setters []func(reflect.Value, mapstructure.DecodeHookFunc) error) func(reflect.Value, mapstructure.DecodeHookFunc) error {
+	if len(setters) == 0 {
+		return nil
+	}
+	return func(v reflect.Value, hook mapstructure.DecodeHookFunc) error {
+		for _, set := range setters {
+			if err := set(v, hook); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// hasComplexFields tells whether a complex number can be decoded somewhere
+// in a t, seen holding the structs already visited.
+func hasComplexFields(t reflect.Type, seen map[reflect.Type]bool) bool {
+	switch t.Kind() {
+	case reflect.Complex64, reflect.Complex128:
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return hasComplexFields(t.Elem(), seen)
+	case reflect.Struct:
+		if seen[t] {
+			return false
+		}
+		seen[t] = true
+		for i := 0; i < t.NumField(); i++ {
+			if hasComplexFields(t.Field(i).Type, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mapstructureField returns the field of the struct t that mapstructure
+// decodes key into, looking into its squashed structs too.
+func mapstructureField(t reflect.Type, key string) (reflect.StructField, bool) {
+	var folded *reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("mapstructure"), ",")
+		name := tag[0]
+		if name == "" {
+			name = field.Name
+		}
+		squash := false
+		for _, opt := range tag[1:] {
+			squash = squash || opt == "squash"
+		}
+		if squash && field.Type.Kind() == reflect.Struct {
+			if f, found := mapstructureField(field.Type, key); found {
+				f.Index = append([]int{i}, f.Index...)
+				return f, true
+			}
+			continue
+		}
+		switch {
+		case name == key:
+			return field, true
+		case folded == nil && strings.EqualFold(name, key):
+			folded = &field
+		}
+	}
+	if folded != nil {
+		return *folded, true
+	}
+	return reflect.StructField{}, false
+}
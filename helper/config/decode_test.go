@@ -2,6 +2,7 @@ package config
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -10,10 +11,15 @@ import (
 
 func TestDecode(t *testing.T) {
 	type Target struct {
-		Name    string
-		Address string
-		Time    time.Duration
-		Trilean Trilean
+		Name      string
+		Address   string
+		Time      time.Duration
+		Trilean   Trilean
+		Separator rune
+		Offset    int32
+		Impedance complex128
+		Expiry    time.Time
+		Stamps    []time.Time
 	}
 
 	cases := map[string]struct {
@@ -37,6 +43,46 @@ func TestDecode(t *testing.T) {
 			nil,
 		},
 
+		"rune": {
+			[]interface{}{
+				map[string]interface{}{
+					"separator": "é",
+					"offset":    "42",
+				},
+			},
+			&Target{
+				Separator: 'é',
+				Offset:    42,
+			},
+			nil,
+		},
+
+		"complex": {
+			[]interface{}{
+				map[string]interface{}{
+					"impedance": "(1+2i)",
+				},
+			},
+			&Target{
+				Impedance: 1 + 2i,
+			},
+			nil,
+		},
+
+		"rfc3339": {
+			[]interface{}{
+				map[string]interface{}{
+					"expiry": "2006-01-02T15:04:05Z",
+					"stamps": []interface{}{"2006-01-02T15:04:05Z"},
+				},
+			},
+			&Target{
+				Expiry: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+				Stamps: []time.Time{time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)},
+			},
+			nil,
+		},
+
 		"empty-string-trilean": {
 			[]interface{}{
 				map[string]interface{}{
@@ -133,3 +179,41 @@ func TestDecode(t *testing.T) {
 		}
 	}
 }
+
+func TestDecode_complexFields(t *testing.T) {
+	type Disk struct {
+		Impedance *complex64 `mapstructure:"impedance"`
+	}
+	type Common struct {
+		Gain complex128 `mapstructure:"gain"`
+	}
+	type Target struct {
+		Common `mapstructure:",squash"`
+		Name   string `mapstructure:"name"`
+		Disk   *Disk  `mapstructure:"disk"`
+		Disks  []Disk `mapstructure:"disks"`
+	}
+
+	var result Target
+	err := Decode(&result, &DecodeOpts{}, map[string]interface{}{
+		"name": "a",
+		"gain": 2.5,
+		"disk": map[string]interface{}{"impedance": "(1-1i)"},
+		"disks": []interface{}{
+			map[string]interface{}{},
+			map[string]interface{}{"impedance": "3i"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Name != "a" || result.Gain != 2.5 || *result.Disk.Impedance != 1-1i ||
+		len(result.Disks) != 2 || result.Disks[0].Impedance != nil || *result.Disks[1].Impedance != 3i {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	err = Decode(&result, &DecodeOpts{}, map[string]interface{}{"gain": "1+"})
+	if err == nil || !strings.Contains(err.Error(), "error decoding 'gain'") {
+		t.Fatalf("expected an error decoding gain, got %v", err)
+	}
+}
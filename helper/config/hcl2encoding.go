@@ -0,0 +1,233 @@
+package config
+
+import (
+	"encoding/base64"
+	"reflect"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/gocty"
+)
+
+// The Flat structs generated by mapstructure-to-hcl2 set some fields in
+// another form than the one of their Go type, described by their
+// `hcl2encoding` tag, ex: a []byte field tagged `hcl2encoding:"base64"` is a
+// base64 string in HCL. The following functions convert between the two
+// forms, so that gocty can convert the values of those fields.
+
+// WalkAttributes calls fn with each attribute of val, an object value of the
+// HCL2Spec of flat, and the field of flat it is set in, including the
+// attributes of the nested blocks. path is the path of the attribute in val.
+// The attributes are replaced by the value fn returns, whose type must be
+// the same for the elements of a list of blocks. The walk stops at the first
+// error.
+func WalkAttributes(val cty.Value, flat interface{}, fn func(path cty.Path, field reflect.StructField, v cty.Value) (cty.Value, error)) (cty.Value, error) {
+	return walkAttributes(nil, val, reflect.TypeOf(flat), fn)
+}
+
+func walkAttributes(path cty.Path, val cty.Value, t reflect.Type, fn func(cty.Path, reflect.StructField, cty.Value) (cty.Value, error)) (cty.Value, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || val.IsNull() || !val.IsKnown() || !val.Type().IsObjectType() {
+		return val, nil
+	}
+	attrs := val.AsValueMap()
+	if len(attrs) == 0 {
+		return val, nil
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("cty")
+		if name == "" || !val.Type().HasAttribute(name) {
+			continue
+		}
+		attrPath := path.GetAttr(name)
+		v, err := walkBlocks(attrPath, attrs[name], field.Type, fn)
+		if err != nil {
+			return val, err
+		}
+		if attrs[name], err = fn(attrPath, field, v); err != nil {
+			return val, err
+		}
+	}
+	return cty.ObjectVal(attrs), nil
+}
+
+// walkBlocks walks the attributes of val when it is a block, or a list of
+// blocks, of the Flat struct t.
+func walkBlocks(path cty.Path, val cty.Value, t reflect.Type, fn func(cty.Path, reflect.StructField, cty.Value) (cty.Value, error)) (cty.Value, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		return walkAttributes(path, val, t, fn)
+	case reflect.Slice, reflect.Array:
+	default:
+		return val, nil
+	}
+	elem := t.Elem()
+	for elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	ty := val.Type()
+	if elem.Kind() != reflect.Struct || val.IsNull() || !val.IsKnown() || val.LengthInt() == 0 ||
+		!ty.IsListType() && !ty.IsTupleType() && !ty.IsSetType() {
+		return val, nil
+	}
+	elems := val.AsValueSlice()
+	for i := range elems {
+		var err error
+		if elems[i], err = walkAttributes(path.Index(cty.NumberIntVal(int64(i))), elems[i], elem, fn); err != nil {
+			return val, err
+		}
+	}
+	switch {
+	case ty.IsListType():
+		return cty.ListVal(elems), nil
+	case ty.IsSetType():
+		return cty.SetVal(elems), nil
+	}
+	return cty.TupleVal(elems), nil
+}
+
+// DecodeBase64Attributes decodes the base64 strings set for the fields of
+// flat tagged `hcl2encoding:"base64"` into lists of bytes, so that gocty can
+// set them in their []byte fields.
+func DecodeBase64Attributes(val cty.Value, flat interface{}) (cty.Value, error) {
+	return WalkAttributes(val, flat, func(path cty.Path, field reflect.StructField, v cty.Value) (cty.Value, error) {
+		if field.Tag.Get("hcl2encoding") != "base64" {
+			return v, nil
+		}
+		if v.IsNull() {
+			return cty.NullVal(cty.List(cty.Number)), nil
+		}
+		if !v.IsKnown() || !v.Type().Equals(cty.String) {
+			return v, nil
+		}
+		b, err := base64.StdEncoding.DecodeString(v.AsString())
+		if err != nil {
+			return v, path.NewErrorf("must be base64 encoded: %v", err)
+		}
+		if len(b) == 0 {
+			return cty.ListValEmpty(cty.Number), nil
+		}
+		bytes := make([]cty.Value, len(b))
+		for i := range b {
+			bytes[i] = cty.NumberUIntVal(uint64(b[i]))
+		}
+		return cty.ListVal(bytes), nil
+	})
+}
+
+// EncodeBase64Attributes encodes the lists of bytes set for the fields of
+// flat tagged `hcl2encoding:"base64"` into base64 strings, the inverse of
+// DecodeBase64Attributes.
+func EncodeBase64Attributes(val cty.Value, flat interface{}) (cty.Value, error) {
+	return WalkAttributes(val, flat, func(path cty.Path, field reflect.StructField, v cty.Value) (cty.Value, error) {
+		if field.Tag.Get("hcl2encoding") != "base64" || !v.Type().Equals(cty.List(cty.Number)) {
+			return v, nil
+		}
+		if v.IsNull() {
+			return cty.NullVal(cty.String), nil
+		}
+		if !v.IsKnown() {
+			return cty.UnknownVal(cty.String), nil
+		}
+		var b []byte
+		if err := gocty.FromCtyValue(v, &b); err != nil {
+			return v, path.NewError(err)
+		}
+		return cty.StringVal(base64.StdEncoding.EncodeToString(b)), nil
+	})
+}
+
+// ToCtyValue is like gocty.ToCtyValue for flat, a Flat struct, and ty, the
+// type implied by its HCL2Spec, except that its base64 fields are encoded.
+func ToCtyValue(flat interface{}, ty cty.Type) (cty.Value, error) {
+	v, err := gocty.ToCtyValue(flat, base64ImpliedType(ty, reflect.TypeOf(flat)))
+	if err != nil {
+		return v, err
+	}
+	if v, err = EncodeBase64Attributes(v, flat); err != nil {
+		return v, err
+	}
+	return retype(v, ty), nil
+}
+
+// FromCtyValue is like gocty.FromCtyValue for val, a value decoded with the
+// HCL2Spec of flat, except that its base64 attributes are decoded.
+func FromCtyValue(val cty.Value, flat interface{}) error {
+	val, err := DecodeBase64Attributes(val, flat)
+	if err != nil {
+		return err
+	}
+	return gocty.FromCtyValue(val, flat)
+}
+
+// retype returns v typed ty. The known values of v already are, but not its
+// null blocks, whose type still holds the lists of bytes of their base64
+// attributes.
+func retype(v cty.Value, ty cty.Type) cty.Value {
+	switch {
+	case v.IsNull():
+		return cty.NullVal(ty)
+	case !v.IsKnown():
+		return cty.UnknownVal(ty)
+	case ty.IsObjectType() && v.Type().IsObjectType() && len(ty.AttributeTypes()) > 0:
+		attrs := v.AsValueMap()
+		for name, attr := range attrs {
+			attrs[name] = retype(attr, ty.AttributeType(name))
+		}
+		return cty.ObjectVal(attrs)
+	case ty.IsListType() && v.Type().IsListType():
+		if v.LengthInt() == 0 {
+			return cty.ListValEmpty(ty.ElementType())
+		}
+		elems := v.AsValueSlice()
+		for i := range elems {
+			elems[i] = retype(elems[i], ty.ElementType())
+		}
+		return cty.ListVal(elems)
+	}
+	return v
+}
+
+// base64ImpliedType returns ty, the type of a value of the Flat struct t,
+// with the lists of bytes that gocty converts its base64 fields to.
+func base64ImpliedType(ty cty.Type, t reflect.Type) cty.Type {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	switch {
+	case t.Kind() != reflect.Struct:
+		return ty
+	case ty.IsListType():
+		return cty.List(base64ImpliedType(ty.ElementType(), t))
+	case ty.IsSetType():
+		return cty.Set(base64ImpliedType(ty.ElementType(), t))
+	case !ty.IsObjectType():
+		return ty
+	}
+	attrs := ty.AttributeTypes()
+	if len(attrs) == 0 {
+		return ty
+	}
+	types := make(map[string]cty.Type, len(attrs))
+	for name, attr := range attrs {
+		types[name] = attr
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("cty")
+		if _, found := types[name]; !found {
+			continue
+		}
+		if field.Tag.Get("hcl2encoding") == "base64" {
+			types[name] = cty.List(cty.Number)
+		} else {
+			types[name] = base64ImpliedType(types[name], field.Type)
+		}
+	}
+	return cty.Object(types)
+}
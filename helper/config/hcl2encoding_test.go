@@ -0,0 +1,72 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+type flatEncodedDisk struct {
+	Data []byte `cty:"data" hcl2encoding:"base64"`
+}
+
+type flatEncoded struct {
+	Name  *string           `cty:"name"`
+	Data  []byte            `cty:"data" hcl2encoding:"base64"`
+	Disk  *flatEncodedDisk  `cty:"disk"`
+	Disks []flatEncodedDisk `cty:"disks"`
+}
+
+var flatEncodedType = cty.Object(map[string]cty.Type{
+	"name":  cty.String,
+	"data":  cty.String,
+	"disk":  cty.Object(map[string]cty.Type{"data": cty.String}),
+	"disks": cty.List(cty.Object(map[string]cty.Type{"data": cty.String})),
+})
+
+func TestBase64RoundTrip(t *testing.T) {
+	name := "a"
+	c := &flatEncoded{
+		Name:  &name,
+		Data:  []byte("hi"),
+		Disks: []flatEncodedDisk{{Data: []byte("yo")}, {}},
+	}
+	v, err := ToCtyValue(c, flatEncodedType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.Type().Equals(flatEncodedType) {
+		t.Fatalf("expected a %#v, got a %#v", flatEncodedType, v.Type())
+	}
+	disks := v.GetAttr("disks").AsValueSlice()
+	if v.GetAttr("data").AsString() != "aGk=" || disks[0].GetAttr("data").AsString() != "eW8=" || !disks[1].GetAttr("data").IsNull() {
+		t.Fatalf("unexpected value %#v", v)
+	}
+
+	v, err = DecodeBase64Attributes(v, &flatEncoded{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := v.GetAttr("disks").Index(cty.NumberIntVal(0)).GetAttr("data"); !got.Type().Equals(cty.List(cty.Number)) || got.LengthInt() != 2 {
+		t.Fatalf("expected a list of 2 bytes, got %#v", got)
+	}
+}
+
+func TestDecodeBase64Attributes_path(t *testing.T) {
+	val := cty.ObjectVal(map[string]cty.Value{
+		"disks": cty.ListVal([]cty.Value{
+			cty.ObjectVal(map[string]cty.Value{"data": cty.StringVal("aGk=")}),
+			cty.ObjectVal(map[string]cty.Value{"data": cty.StringVal("hi!")}),
+		}),
+	})
+	_, err := DecodeBase64Attributes(val, &flatEncoded{})
+	pathErr, ok := err.(cty.PathError)
+	if !ok {
+		t.Fatalf("expected a path error, got %v", err)
+	}
+	expected := cty.GetAttrPath("disks").Index(cty.NumberIntVal(1)).GetAttr("data")
+	if !pathErr.Path.Equals(expected) || !strings.HasPrefix(err.Error(), "must be base64 encoded") {
+		t.Fatalf("unexpected error %#v", err)
+	}
+}
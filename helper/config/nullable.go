@@ -0,0 +1,168 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/gocty"
+)
+
+// The Nullable types are the fields of the Flat structs generated with
+// mapstructure-to-hcl2 -keep-zero-value-distinction: IsSet tells whether
+// the attribute was set, so that an explicit zero value, ex: `port = 0`, can
+// be told apart from an unset attribute without nil checks.
+
+// NullableBool is a bool that knows whether it was set.
+type NullableBool struct {
+	Value bool
+	IsSet bool
+}
+
+// FromCtyValue sets n from v, a null v unsets it.
+func (n *NullableBool) FromCtyValue(v cty.Value) error {
+	*n = NullableBool{}
+	if v.IsNull() {
+		return nil
+	}
+	n.IsSet = true
+	return gocty.FromCtyValue(v, &n.Value)
+}
+
+// CtyValue returns the cty value of n, null when it is not set.
+func (n NullableBool) CtyValue() cty.Value {
+	if !n.IsSet {
+		return cty.NullVal(cty.Bool)
+	}
+	return cty.BoolVal(n.Value)
+}
+
+func (n NullableBool) String() string {
+	if !n.IsSet {
+		return "nil"
+	}
+	return fmt.Sprint(n.Value)
+}
+
+// NullableInt is a signed integer that knows whether it was set.
+type NullableInt struct {
+	Value int64
+	IsSet bool
+}
+
+// FromCtyValue sets n from v, a null v unsets it.
+func (n *NullableInt) FromCtyValue(v cty.Value) error {
+	*n = NullableInt{}
+	if v.IsNull() {
+		return nil
+	}
+	n.IsSet = true
+	return gocty.FromCtyValue(v, &n.Value)
+}
+
+// CtyValue returns the cty value of n, null when it is not set.
+func (n NullableInt) CtyValue() cty.Value {
+	if !n.IsSet {
+		return cty.NullVal(cty.Number)
+	}
+	return cty.NumberIntVal(n.Value)
+}
+
+func (n NullableInt) String() string {
+	if !n.IsSet {
+		return "nil"
+	}
+	return fmt.Sprint(n.Value)
+}
+
+// NullableUint is an unsigned integer that knows whether it was set.
+type NullableUint struct {
+	Value uint64
+	IsSet bool
+}
+
+// FromCtyValue sets n from v, a null v unsets it.
+func (n *NullableUint) FromCtyValue(v cty.Value) error {
+	*n = NullableUint{}
+	if v.IsNull() {
+		return nil
+	}
+	n.IsSet = true
+	return gocty.FromCtyValue(v, &n.Value)
+}
+
+// CtyValue returns the cty value of n, null when it is not set.
+func (n NullableUint) CtyValue() cty.Value {
+	if !n.IsSet {
+		return cty.NullVal(cty.Number)
+	}
+	return cty.NumberUIntVal(n.Value)
+}
+
+func (n NullableUint) String() string {
+	if !n.IsSet {
+		return "nil"
+	}
+	return fmt.Sprint(n.Value)
+}
+
+// NullableFloat is a float that knows whether it was set.
+type NullableFloat struct {
+	Value float64
+	IsSet bool
+}
+
+// FromCtyValue sets n from v, a null v unsets it.
+func (n *NullableFloat) FromCtyValue(v cty.Value) error {
+	*n = NullableFloat{}
+	if v.IsNull() {
+		return nil
+	}
+	n.IsSet = true
+	return gocty.FromCtyValue(v, &n.Value)
+}
+
+// CtyValue returns the cty value of n, null when it is not set.
+func (n NullableFloat) CtyValue() cty.Value {
+	if !n.IsSet {
+		return cty.NullVal(cty.Number)
+	}
+	return cty.NumberFloatVal(n.Value)
+}
+
+func (n NullableFloat) String() string {
+	if !n.IsSet {
+		return "nil"
+	}
+	return fmt.Sprint(n.Value)
+}
+
+// NullableString is a string that knows whether it was set.
+type NullableString struct {
+	Value string
+	IsSet bool
+}
+
+// FromCtyValue sets n from v, a null v unsets it.
+func (n *NullableString) FromCtyValue(v cty.Value) error {
+	*n = NullableString{}
+	if v.IsNull() {
+		return nil
+	}
+	n.IsSet = true
+	return gocty.FromCtyValue(v, &n.Value)
+}
+
+// CtyValue returns the cty value of n, null when it is not set.
+func (n NullableString) CtyValue() cty.Value {
+	if !n.IsSet {
+		return cty.NullVal(cty.String)
+	}
+	return cty.StringVal(n.Value)
+}
+
+func (n NullableString) String() string {
+	if !n.IsSet {
+		return "nil"
+	}
+	return fmt.Sprintf("%q", n.Value)
+}
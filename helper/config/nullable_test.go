@@ -0,0 +1,46 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestNullableRoundTrip(t *testing.T) {
+	var n NullableInt
+	if err := n.FromCtyValue(cty.NumberIntVal(0)); err != nil {
+		t.Fatal(err)
+	}
+	if !n.IsSet || n.Value != 0 {
+		t.Fatalf("expected a set 0, got %#v", n)
+	}
+	if v := n.CtyValue(); !v.RawEquals(cty.NumberIntVal(0)) {
+		t.Fatalf("expected 0, got %#v", v)
+	}
+
+	if err := n.FromCtyValue(cty.NullVal(cty.Number)); err != nil {
+		t.Fatal(err)
+	}
+	if n.IsSet {
+		t.Fatalf("expected an unset int, got %#v", n)
+	}
+	if v := n.CtyValue(); !v.IsNull() {
+		t.Fatalf("expected null, got %#v", v)
+	}
+
+	var s NullableString
+	if err := s.FromCtyValue(cty.StringVal("")); err != nil {
+		t.Fatal(err)
+	}
+	if s.String() != `""` {
+		t.Fatalf("expected an empty string, got %s", s)
+	}
+	if (NullableString{}).String() != "nil" {
+		t.Fatalf("expected nil, got %s", NullableString{})
+	}
+
+	var u NullableUint
+	if err := u.FromCtyValue(cty.NumberIntVal(-1)); err == nil {
+		t.Fatal("expected an error for a negative uint")
+	}
+}